@@ -0,0 +1,70 @@
+package flog
+
+import (
+	"bufio"
+	"os"
+)
+
+/**
+ * 异步模式下为文件创建写缓冲,日志先写入缓冲,按大小或者AsyncFlushInterval写入文件
+ * 多进程写同一个文件时不缓冲,避免一行日志被拆成两次写入和其他进程的日志交错
+ */
+func (this *Flog ) newBuffer(filename string, fh *os.File) {
+	delete(this.bufMap, filename)
+	delete(this.sizeMap, filename)
+	if !this.async || this.MultiProcess || this.AsyncBufferSize < 0 {
+		return
+	}
+	size := this.AsyncBufferSize << 10
+	if size == 0 {
+		size = 64 << 10
+	}
+	var fileSize int64
+	if info, err := fh.Stat(); err == nil {
+		fileSize = info.Size()
+	}
+	bw := bufio.NewWriterSize(fh, size)
+	this.bufMap[filename] = bw
+	this.sizeMap[filename] = fileSize
+	this.logerMap[filename].SetOutput(bw)
+}
+
+//把文件的写缓冲写入文件,需要持有锁
+func (this *Flog ) flushBuffer(filename string) error {
+	if bw, ok := this.bufMap[filename]; ok {
+		if err := bw.Flush(); err != nil {
+			this.resetBuffer(filename)
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * bufio.Writer出错之后会一直返回同一个错误,例如磁盘写满之后即使有了空间也写不进去
+ * 出错时丢弃缓冲中没有写入的日志,重新绑定文件,文件大小以实际写入的为准,需要持有锁
+ */
+func (this *Flog ) resetBuffer(filename string) {
+	bw, ok := this.bufMap[filename]
+	if !ok {
+		return
+	}
+	fh := this.fhMap[filename]
+	bw.Reset(fh)
+	if info, err := fh.Stat(); err == nil {
+		this.sizeMap[filename] = info.Size()
+	}
+}
+
+//把所有文件的写缓冲写入文件
+func (this *Flog ) flushBuffers() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	var err error
+	for filename := range this.bufMap {
+		if e := this.flushBuffer(filename); e != nil {
+			err = e
+		}
+	}
+	return err
+}
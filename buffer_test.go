@@ -0,0 +1,89 @@
+package flog
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+//测试异步模式下的写缓冲,Flush之后才写入文件
+func TestAsyncBuffer(t *testing.T) {
+	loger := New("/tmp/flog_buffer")
+	defer os.RemoveAll(loger.LogPath)
+	loger.AsyncFlushInterval = 60000
+	loger.SetAsync(10)
+	filename := path.Join(loger.LogPath, loger.FileName)
+	loger.Debug("d", "buffered")
+	loger.Flush()
+	b, _ := os.ReadFile(filename)
+	if !strings.Contains(string(b), "buffered") {
+		t.Fatal("Buffer was not flushed.", string(b))
+	}
+	loger.Debug("d", "closed")
+	loger.Close()
+	b, _ = os.ReadFile(filename)
+	if !strings.Contains(string(b), "closed") {
+		t.Fatal("Buffer was not flushed when closing.", string(b))
+	}
+}
+
+//测试带缓冲时按大小切割
+func TestAsyncBufferRotate(t *testing.T) {
+	loger := New("/tmp/flog_buffer_rotate")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogFlags = []int{LF_CATE}
+	loger.LogRotateSize = 1
+	loger.LogRotateNaming = ROTATENAME_SEQ
+	loger.SetAsync(10)
+	line := strings.Repeat("x", 600)
+	loger.Debug("a", line)
+	loger.Debug("b", line)
+	loger.Debug("c", line)
+	loger.Close()
+
+	rotated, _ := os.ReadFile(path.Join(loger.LogPath, loger.FileName + ".1"))
+	live, _ := os.ReadFile(path.Join(loger.LogPath, loger.FileName))
+	if string(rotated) != "a " + line + "\nb " + line + "\n" || string(live) != "c " + line + "\n" {
+		t.Fatal("Rotation with buffer does not work as expected.", len(rotated), len(live))
+	}
+}
+
+//写入总是失败的writer,模拟磁盘写满
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+//测试缓冲写入失败之后可以恢复,不会一直返回同一个错误
+func TestAsyncBufferRecover(t *testing.T) {
+	loger := New("/tmp/flog_buffer_recover")
+	defer os.RemoveAll(loger.LogPath)
+	loger.AsyncFlushInterval = 60000
+	var errs []string
+	loger.ErrorHandler = func(op string, err error) {
+		errs = append(errs, op + ": " + err.Error())
+	}
+	loger.SetAsync(10)
+	loger.Debug("d", "before")
+	loger.Flush()
+
+	//缓冲中的下一次写入失败
+	loger.mu.Lock()
+	loger.bufMap[loger.FileName].Reset(failWriter{})
+	loger.mu.Unlock()
+	loger.Debug("d", "lost")
+	loger.Flush()
+	loger.Debug("d", "after")
+	loger.Close()
+
+	b, _ := os.ReadFile(path.Join(loger.LogPath, loger.FileName))
+	if !strings.Contains(string(b), "before") || !strings.Contains(string(b), "after") {
+		t.Fatal("Buffer should recover after a failed write.", string(b))
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0], "no space left on device") {
+		t.Fatal("Flush error should be reported once.", errs)
+	}
+}
@@ -0,0 +1,120 @@
+package flog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+//日志已经关闭
+var ErrClosed = errors.New("flog: logger is closed")
+
+//发给collect的flush和close信号,处理完成之后关闭done
+type flushSignal struct {
+	kind string
+	done chan struct{}
+}
+
+//超时之前没有写完所有的日志
+type FlushError struct {
+	Pending int   //还没有写入的消息数
+	Err     error //ctx的错误
+}
+
+func (this *FlushError ) Error() string {
+	return "flog: " + strconv.Itoa(this.Pending) + " messages still pending, " + this.Err.Error()
+}
+
+func (this *FlushError ) Unwrap() error {
+	return this.Err
+}
+
+/**
+ * 把队列和缓冲中的日志全部写入,可以多个goroutine同时调用
+ * ctx超时时返回*FlushError,包含还没有写入的消息数,flush会在后台继续执行
+ *
+ * @param ctx context.Context
+ * @return error 关闭之后调用返回ErrClosed
+ *
+ */
+func (this *Flog ) FlushContext(ctx context.Context) error {
+	//解锁之后再回调ErrorHandler
+	defer this.deliverErrors()
+	this.closeMu.RLock()
+	defer this.closeMu.RUnlock()
+	if this.closed {
+		return ErrClosed
+	}
+	this.init()
+
+	done := make(chan struct{})
+	if this.async {
+		signal := &flushSignal{kind:"flush", done:done}
+		select {
+		case this.signalChan <- signal:
+		case <-ctx.Done():
+			return &FlushError{Pending:len(this.msgChan), Err:ctx.Err()}
+		}
+	}else {
+		go func() {
+			this.flushSinks()
+			close(done)
+		}()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return &FlushError{Pending:this.pending(), Err:ctx.Err()}
+	}
+}
+
+/**
+ * 关闭日志,先写完队列和缓冲中的日志再关闭所有的输出,关闭之后的日志会被丢弃
+ * 可以重复调用和多个goroutine同时调用,都会等待同一次关闭完成
+ * ctx超时时返回*FlushError,关闭会在后台继续执行
+ *
+ * @param ctx context.Context
+ * @return error
+ *
+ */
+func (this *Flog ) CloseContext(ctx context.Context) error {
+	this.closeOnce.Do(func() {
+		this.closeDone = make(chan struct{})
+		go this.doClose()
+	})
+	select {
+	case <-this.closeDone:
+		return nil
+	case <-ctx.Done():
+		return &FlushError{Pending:this.pending(), Err:ctx.Err()}
+	}
+}
+
+//执行关闭,等待正在写的日志和flush完成之后不再接受新的日志
+func (this *Flog ) doClose() {
+	this.closeMu.Lock()
+	this.closed = true
+	this.closeMu.Unlock()
+
+	this.init()
+	if this.async {
+		signal := &flushSignal{kind:"close", done:make(chan struct{})}
+		this.signalChan <- signal
+		//等待执行完成
+		<-signal.done
+	}
+	this.stopReopenSignal()
+	this.stopWatchConfig()
+	this.closeSinks()
+	this.deliverErrors()
+	close(this.closeDone)
+}
+
+//队列中还没有写入的消息数
+func (this *Flog ) pending() int {
+	if this.msgChan == nil {
+		return 0
+	}
+	return len(this.msgChan)
+}
@@ -0,0 +1,78 @@
+package flog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+//测试重复关闭,关闭之后写日志和flush
+func TestCloseTwice(t *testing.T) {
+	loger := New("/tmp/flog_close")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetAsync(10)
+	loger.Debug("d", "debug_message")
+	loger.Close()
+	loger.Close()
+	loger.Debug("d", "after close")
+	if err := loger.FlushContext(context.Background()); err != ErrClosed {
+		t.Fatal("Flush after close should return ErrClosed,", err)
+	}
+}
+
+//测试多个goroutine同时写日志和flush
+func TestConcurrentFlush(t *testing.T) {
+	loger := New("/tmp/flog_flush")
+	defer os.RemoveAll(loger.LogPath)
+	loger.DisableFileLog = true
+	mem := &MemorySink{}
+	loger.AddSink(mem)
+	loger.SetAsync(100)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				loger.Info("f", "msg")
+				loger.Flush()
+			}
+		}()
+	}
+	wg.Wait()
+	loger.Close()
+	if len(mem.Messages()) != 100 {
+		t.Fatal("Messages were lost,", len(mem.Messages()))
+	}
+}
+
+//测试关闭超时,返回还没有写入的消息数
+func TestCloseContextTimeout(t *testing.T) {
+	loger := New("/tmp/flog_close_timeout")
+	defer os.RemoveAll(loger.LogPath)
+	loger.DisableFileLog = true
+	sink := &blockingSink{started:make(chan bool), release:make(chan bool)}
+	loger.AddSink(sink)
+	loger.SetAsync(10)
+	loger.Info("c", "block")
+	<-sink.started
+	loger.Info("c", "pending")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+	err := loger.CloseContext(ctx)
+	var flushErr *FlushError
+	if !errors.As(err, &flushErr) || flushErr.Pending != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Close should time out with 1 pending message,", err)
+	}
+	close(sink.release)
+	if err := loger.CloseContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.Messages()) != 2 {
+		t.Fatal("Pending messages should be written after close finished,", len(sink.Messages()))
+	}
+}
@@ -0,0 +1,111 @@
+package flog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+/**
+ * 压缩切割和归档之后的日志文件
+ * 标准库没有zstd,需要zstd时可以基于第三方库实现该接口
+ */
+type Compressor interface {
+	Ext() string                                //压缩文件的扩展名,eg. .gz
+	Compress(dst io.Writer, src io.Reader) error
+}
+
+//gzip压缩
+type GzipCompressor struct {
+	Level int //压缩级别,默认为gzip.DefaultCompression
+}
+
+func (this *GzipCompressor ) Ext() string {
+	return ".gz"
+}
+
+func (this *GzipCompressor ) Compress(dst io.Writer, src io.Reader) error {
+	level := this.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	zw, err := gzip.NewWriterLevel(dst, level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+//压缩文件,失败时交给ErrorHandler处理
+func (this *Flog ) compressFileAndReport(conf *fileConf, filePath string) {
+	if err := this.compressFile(conf, filePath); err != nil {
+		this.handleError("compress", err)
+	}
+}
+
+//压缩文件的扩展名,未开启压缩时为空,需要持有锁
+func (this *Flog ) compressExt() string {
+	if this.LogCompress == nil {
+		return ""
+	}
+	return this.LogCompress.Ext()
+}
+
+/**
+ * 压缩文件,先写到临时文件再重命名,不会留下压缩了一半的文件
+ * 压缩之后的文件保留原文件的修改时间,归档和清理时与未压缩的文件一样处理
+ *
+ * @param conf *fileConf 配置快照
+ * @param filePath string 要压缩的文件
+ * @return error
+ *
+ */
+func (this *Flog ) compressFile(conf *fileConf, filePath string) error {
+	ext := conf.compressExt()
+	if len(ext) == 0 || strings.HasSuffix(filePath, ext) {
+		return nil
+	}
+	//同一个文件只压缩一次
+	if _, loaded := this.compressing.LoadOrStore(filePath, true); loaded {
+		return nil
+	}
+	defer this.compressing.Delete(filePath)
+
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstPath := filePath + ext
+	tmpPath := dstPath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY | os.O_CREATE | os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	err = conf.compressor.Compress(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		os.Chtimes(tmpPath, info.ModTime(), info.ModTime())
+		err = renameNoReplace(tmpPath, dstPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Remove(filePath)
+}
@@ -0,0 +1,326 @@
+package flog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/**
+ * 配置文件的解析函数,以扩展名区分,默认只支持json
+ * 可以注册其他格式的解析函数,eg. flog.ConfigDecoders[".yaml"] = yaml.Unmarshal
+ * 需要在读取配置文件之前注册
+ */
+var ConfigDecoders = map[string]func(data []byte, v interface{}) error{
+	".json":json.Unmarshal,
+}
+
+//日志的配置,没有配置的项使用默认值,与Flog的同名字段含义相同
+type Config struct {
+	LogPath          string            `json:"log_path" yaml:"log_path" toml:"log_path"`
+	FileName         string            `json:"file_name" yaml:"file_name" toml:"file_name"`
+	LogMode          string            `json:"log_mode" yaml:"log_mode" toml:"log_mode"`                   //file file_level cate cate_level
+	DateFormat       string            `json:"date_format" yaml:"date_format" toml:"date_format"`
+	LogFormat        string            `json:"log_format" yaml:"log_format" toml:"log_format"`             //text json
+	LogFlags         []string          `json:"log_flags" yaml:"log_flags" toml:"log_flags"`                //datetime shortfile longfile cate level
+	LogFlagSeparator string            `json:"log_flag_separator" yaml:"log_flag_separator" toml:"log_flag_separator"`
+	Level            string            `json:"level" yaml:"level" toml:"level"`                            //trace debug info warning error panic fatal
+	CategoryLevels   map[string]string `json:"category_levels" yaml:"category_levels" toml:"category_levels"`
+	OpenConsoleLog   bool              `json:"open_console_log" yaml:"open_console_log" toml:"open_console_log"`
+	Async            int64             `json:"async" yaml:"async" toml:"async"`                            //异步队列的容量,0表示同步写,只在创建时生效
+	LogRotateSize    int               `json:"log_rotate_size" yaml:"log_rotate_size" toml:"log_rotate_size"`
+	LogRotateInterval int              `json:"log_rotate_interval" yaml:"log_rotate_interval" toml:"log_rotate_interval"`
+	LogRotateNaming  string            `json:"log_rotate_naming" yaml:"log_rotate_naming" toml:"log_rotate_naming"` //time seq
+	LogRotateKeepExt bool              `json:"log_rotate_keep_ext" yaml:"log_rotate_keep_ext" toml:"log_rotate_keep_ext"`
+	LogCompress      string            `json:"log_compress" yaml:"log_compress" toml:"log_compress"`       //gzip,为空时不压缩
+	NeedArchive      bool              `json:"need_archive" yaml:"need_archive" toml:"need_archive"`
+	ArchivePath      string            `json:"archive_path" yaml:"archive_path" toml:"archive_path"`
+	LogKeepDay       int               `json:"log_keep_day" yaml:"log_keep_day" toml:"log_keep_day"`
+	LogKeepCount     int               `json:"log_keep_count" yaml:"log_keep_count" toml:"log_keep_count"`
+	LogMaxTotalSize  int               `json:"log_max_total_size" yaml:"log_max_total_size" toml:"log_max_total_size"`
+	MultiProcess     bool              `json:"multi_process" yaml:"multi_process" toml:"multi_process"`
+}
+
+var configLogModes = map[string]int{
+	"file":LOGMODE_FILE,
+	"file_level":LOGMODE_FILE_LEVEL,
+	"cate":LOGMODE_CATE,
+	"cate_level":LOGMODE_CATE_LEVEL,
+}
+
+var configLogFormats = map[string]int{
+	"text":LOGFORMAT_TEXT,
+	"json":LOGFORMAT_JSON,
+}
+
+var configLogFlags = map[string]int{
+	"datetime":LF_DATETIME,
+	"shortfile":LF_SHORTFILE,
+	"longfile":LF_LONGFILE,
+	"cate":LF_CATE,
+	"level":LF_LEVEL,
+}
+
+var configRotateNamings = map[string]int{
+	"time":ROTATENAME_TIME,
+	"seq":ROTATENAME_SEQ,
+}
+
+/**
+ * 读取配置文件,根据扩展名选择ConfigDecoders中的解析函数,没有对应的解析函数时按json解析
+ *
+ * @param filename string
+ * @return *Config, error
+ *
+ */
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(filename, data)
+}
+
+func decodeConfig(filename string, data []byte) (*Config, error) {
+	decode, ok := ConfigDecoders[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		decode = json.Unmarshal
+	}
+	conf := new(Config)
+	if err := decode(data, conf); err != nil {
+		return nil, errors.New("flog: fail to parse config " + filename + ": " + err.Error())
+	}
+	return conf, nil
+}
+
+/**
+ * 根据配置实例化一个文件日志
+ *
+ * @param conf *Config
+ * @return *Flog, error
+ *
+ */
+func NewFromConfig(conf *Config) (*Flog, error) {
+	flog := New()
+	if err := flog.ApplyConfig(conf); err != nil {
+		return nil, err
+	}
+	flog.Level = flog.GetLevel()
+	if conf.Async > 0 {
+		flog.SetAsync(conf.Async)
+	}
+	return flog, nil
+}
+
+/**
+ * 根据配置文件实例化一个文件日志
+ *
+ * @param filename string
+ * @return *Flog, error
+ *
+ */
+func NewFromFile(filename string) (*Flog, error) {
+	conf, err := LoadConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConfig(conf)
+}
+
+/**
+ * 运行时应用配置,配置有误时不修改任何配置
+ * 修改时暂停写日志,写完缓冲并关闭所有文件,之后的日志按新的配置写入,不会丢失日志
+ * Async只在创建时生效
+ *
+ * @param conf *Config
+ * @return error
+ *
+ */
+func (this *Flog ) ApplyConfig(conf *Config) error {
+	logMode, err := configEnum("log_mode", conf.LogMode, configLogModes)
+	if err != nil {
+		return err
+	}
+	logFormat, err := configEnum("log_format", conf.LogFormat, configLogFormats)
+	if err != nil {
+		return err
+	}
+	rotateNaming, err := configEnum("log_rotate_naming", conf.LogRotateNaming, configRotateNamings)
+	if err != nil {
+		return err
+	}
+	var logFlags []int
+	for _, name := range conf.LogFlags {
+		flag, err := configEnum("log_flags", name, configLogFlags)
+		if err != nil {
+			return err
+		}
+		logFlags = append(logFlags, flag)
+	}
+	level := LEVEL_DEBUG
+	if len(conf.Level) > 0 {
+		if level, err = ParseLevel(conf.Level); err != nil {
+			return err
+		}
+	}
+	categoryLevels := make(map[string]int, len(conf.CategoryLevels))
+	for category, name := range conf.CategoryLevels {
+		if categoryLevels[category], err = ParseLevel(name); err != nil {
+			return err
+		}
+	}
+	var compressor Compressor
+	switch strings.ToLower(conf.LogCompress) {
+	case "":
+	case "gzip":
+		compressor = &GzipCompressor{}
+	default:
+		return errors.New("flog: unknown log_compress " + conf.LogCompress)
+	}
+
+	//等正在写的日志完成,并暂停新的日志,ErrorHandler可能会写日志,解锁之后再处理错误
+	this.closeMu.Lock()
+	if this.closed {
+		this.closeMu.Unlock()
+		return ErrClosed
+	}
+	this.mu.Lock()
+	err = this.applyConfig(conf, logMode, logFormat, rotateNaming, logFlags, compressor)
+	this.mu.Unlock()
+	this.SetLevel(level)
+	this.setCategoryLevels(categoryLevels)
+	this.closeMu.Unlock()
+	if err != nil {
+		this.handleError("config", err)
+	}
+	return nil
+}
+
+//修改配置,需要持有锁,返回关闭文件时的错误
+func (this *Flog ) applyConfig(conf *Config, logMode, logFormat, rotateNaming int, logFlags []int, compressor Compressor) error {
+	this.init()
+	//文件名或者切割方式可能变化,先写完缓冲并关闭文件,下次写入时按新的配置打开
+	err := this.closeFiles()
+	old := this.fileConf()
+
+	this.LogPath = conf.LogPath
+	this.FileName = conf.FileName
+	this.LogMode = logMode
+	this.DateFormat = conf.DateFormat
+	this.LogFormat = logFormat
+	this.LogFlags = logFlags
+	this.LogFlagSeparator = conf.LogFlagSeparator
+	this.OpenConsoleLog = conf.OpenConsoleLog
+	this.LogRotateSize = conf.LogRotateSize
+	this.LogRotateInterval = conf.LogRotateInterval
+	this.LogRotateNaming = rotateNaming
+	this.LogRotateKeepExt = conf.LogRotateKeepExt
+	this.LogCompress = compressor
+	this.NeedArchive = conf.NeedArchive
+	this.ArchivePath = conf.ArchivePath
+	this.LogKeepDay = conf.LogKeepDay
+	this.LogKeepCount = conf.LogKeepCount
+	this.LogMaxTotalSize = conf.LogMaxTotalSize
+	this.MultiProcess = conf.MultiProcess
+	//没有配置的项使用默认值
+	this.init()
+	//归档的配置变化时当天需要重新归档
+	if newConf := this.fileConf(); newConf.needArchive != old.needArchive || newConf.archiveDir() != old.archiveDir() {
+		this.lastArchiveDay = ""
+		this.archiveRetryAt = time.Time{}
+	}
+	return err
+}
+
+//把配置中的名字转换为常量,为空时使用第一个常量
+func configEnum(key, name string, values map[string]int) (int, error) {
+	if len(name) == 0 {
+		return 0, nil
+	}
+	value, ok := values[strings.ToLower(name)]
+	if !ok {
+		return 0, errors.New("flog: unknown " + key + " " + name)
+	}
+	return value, nil
+}
+
+/**
+ * 定时检查配置文件,文件修改之后重新应用配置,Close时停止
+ * 配置文件读取或者解析失败时交给ErrorHandler,继续使用原来的配置
+ *
+ * @param filename string
+ * @param interval int 检查的间隔,单位毫秒,默认1000
+ * @return *Flog
+ *
+ */
+func (this *Flog ) WatchConfig(filename string, interval int) *Flog {
+	if interval <= 0 {
+		interval = 1000
+	}
+	this.stopWatchConfig()
+	stop := make(chan struct{})
+	this.confMu.Lock()
+	this.configWatch = stop
+	this.confMu.Unlock()
+
+	var modTime time.Time
+	var size int64
+	var last []byte
+	if info, err := os.Stat(filename); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+		last, _ = ioutil.ReadFile(filename)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(filename)
+			if err != nil {
+				this.handleError("config", err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				this.handleError("config", err)
+				continue
+			}
+			//内容没有变化时不需要重新应用
+			if bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			conf, err := decodeConfig(filename, data)
+			if err == nil {
+				err = this.ApplyConfig(conf)
+			}
+			if err != nil {
+				this.handleError("config", err)
+			}
+		}
+	}()
+	return this
+}
+
+//停止检查配置文件
+func (this *Flog ) stopWatchConfig() {
+	this.confMu.Lock()
+	defer this.confMu.Unlock()
+	if this.configWatch != nil {
+		close(this.configWatch)
+		this.configWatch = nil
+	}
+}
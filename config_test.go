@@ -0,0 +1,214 @@
+package flog
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//写配置文件
+func writeConfigFile(t *testing.T, filename, content string) {
+	os.MkdirAll(path.Dir(filename), os.ModePerm)
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//统计日志目录下所有文件的行数
+func countLogLines(dir string) int {
+	n := 0
+	files, _ := os.ReadDir(dir)
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		b, _ := os.ReadFile(path.Join(dir, f.Name()))
+		n += strings.Count(string(b), "\n")
+	}
+	return n
+}
+
+//测试根据配置文件创建日志
+func TestNewFromFile(t *testing.T) {
+	dir := "/tmp/flog_config"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "flog.json")
+	writeConfigFile(t, filename, `{
+		"log_path": "/tmp/flog_config/logs",
+		"file_name": "app.log",
+		"log_mode": "file_level",
+		"log_format": "json",
+		"level": "info",
+		"category_levels": {"db": "debug"},
+		"log_rotate_naming": "seq",
+		"log_compress": "gzip",
+		"log_keep_count": 3
+	}`)
+	loger, err := NewFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loger.LogPath != "/tmp/flog_config/logs" || loger.FileName != "app.log" || loger.LogMode != LOGMODE_FILE_LEVEL ||
+		loger.LogFormat != LOGFORMAT_JSON || loger.Level != LEVEL_INFO || loger.LogRotateNaming != ROTATENAME_SEQ ||
+		loger.LogCompress == nil || loger.LogKeepCount != 3 {
+		t.Fatal("Config was not applied.", loger)
+	}
+	//没有配置的项使用默认值
+	if loger.ArchivePath != "archive" || loger.LogKeepDay != 7 || len(loger.LogFlags) == 0 {
+		t.Fatal("Defaults were not applied.", loger)
+	}
+	loger.Debug("db.query", "db_debug")
+	loger.Debug("http", "http_debug")
+	b, _ := os.ReadFile(path.Join(loger.LogPath, "app.log.debug"))
+	if !strings.Contains(string(b), `"message":"db_debug`) || strings.Contains(string(b), "http_debug") {
+		t.Fatal("Levels from config were not applied.", string(b))
+	}
+}
+
+//测试错误的配置
+func TestApplyConfigInvalid(t *testing.T) {
+	loger := New("/tmp/flog_config_invalid")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetLevel(LEVEL_WARNING)
+	for _, conf := range []*Config{
+		{Level:"loud"},
+		{LogMode:"daily"},
+		{LogFlags:[]string{"datetime", "pid"}},
+		{LogCompress:"zip"},
+	} {
+		if err := loger.ApplyConfig(conf); err == nil {
+			t.Fatal("Invalid config should be rejected.", conf)
+		}
+	}
+	if loger.GetLevel() != LEVEL_WARNING || loger.LogPath != "/tmp/flog_config_invalid" {
+		t.Fatal("Invalid config should not change the logger")
+	}
+	if _, err := NewFromFile("/tmp/flog_config_not_exist.json"); err == nil {
+		t.Fatal("Missing config file should return an error")
+	}
+}
+
+//测试自定义配置文件的解析函数
+func TestConfigDecoders(t *testing.T) {
+	dir := "/tmp/flog_config_decoder"
+	defer os.RemoveAll(dir)
+	//key=value 格式
+	ConfigDecoders[".kv"] = func(data []byte, v interface{}) error {
+		m := make(map[string]string)
+		for _, line := range strings.Split(string(data), "\n") {
+			if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+				m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		b, _ := json.Marshal(m)
+		return json.Unmarshal(b, v)
+	}
+	defer delete(ConfigDecoders, ".kv")
+	filename := path.Join(dir, "flog.kv")
+	writeConfigFile(t, filename, "log_path = /tmp/flog_config_decoder/logs\nlevel = error\n")
+	loger, err := NewFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loger.LogPath != "/tmp/flog_config_decoder/logs" || loger.GetLevel() != LEVEL_ERROR {
+		t.Fatal("Custom decoder was not used.", loger.LogPath, loger.GetLevel())
+	}
+}
+
+//测试修改配置文件之后自动应用,修改时不丢失日志
+func TestWatchConfig(t *testing.T) {
+	dir := "/tmp/flog_config_watch"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "flog.json")
+	writeConfigFile(t, filename, `{"log_path": "/tmp/flog_config_watch/logs", "file_name": "a.log", "level": "debug", "async": 100}`)
+	loger, err := NewFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loger.WatchConfig(filename, 20)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	total := 0
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			loger.Warning("w", "warning_message")
+			total++
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	writeConfigFile(t, filename, `{"log_path": "/tmp/flog_config_watch/logs", "file_name": "b.log", "category_levels": {"x": "error"}, "async": 100}`)
+	for i := 0; i < 100 && loger.CategoryLevel("x") != LEVEL_ERROR; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if loger.CategoryLevel("x") != LEVEL_ERROR {
+		t.Fatal("Levels were not reloaded")
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	loger.Close()
+
+	logDir := "/tmp/flog_config_watch/logs"
+	if !FileExist(path.Join(logDir, "a.log")) || !FileExist(path.Join(logDir, "b.log")) {
+		t.Fatal("Messages should be written to both files")
+	}
+	if n := countLogLines(logDir); n != total {
+		t.Fatal("Line count is wrong.", n, total)
+	}
+}
+
+//测试切割,压缩,归档和清理的同时重新加载配置
+func TestApplyConfigWhileRotating(t *testing.T) {
+	dir := "/tmp/flog_config_rotate"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+	confs := []*Config{
+		{LogPath:dir, LogRotateSize:1, LogRotateNaming:"seq", LogCompress:"gzip", NeedArchive:true, ArchivePath:"a1", LogKeepCount:2},
+		{LogPath:dir, LogRotateSize:1, LogRotateNaming:"seq", NeedArchive:true, ArchivePath:"a2", LogMaxTotalSize:1, MultiProcess:true},
+	}
+	loger, err := NewFromConfig(confs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	//清理可能先删除了还没有压缩的文件
+	loger.ErrorHandler = func(op string, err error) {}
+	touchLogFile(t, path.Join(dir, "old.log"), 10, time.Now().Add(-48 * time.Hour))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			loger.Info("d", strings.Repeat("x", 200))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := loger.ApplyConfig(confs[i % 2]); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+	loger.Close()
+	//等待后台的压缩,归档和清理完成
+	time.Sleep(200 * time.Millisecond)
+}
@@ -0,0 +1,91 @@
+package flog
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+//等待交给ErrorHandler的错误最多保留的数量,超过时只记录和统计不再回调
+const maxPendingErrors = 100
+
+//回调期间产生的错误延迟回调的时间
+const errorRetryDelay = 100 * time.Millisecond
+
+//等待交给ErrorHandler的错误
+type pendingError struct {
+	op  string
+	err error
+}
+
+/**
+ * 处理内部错误,记录为最后一次错误,并交给ErrorHandler
+ * 未设置ErrorHandler时输出到标准错误,只能在没有持有锁的时候调用,持有锁时使用queueError
+ *
+ * @param op string 出错的操作 eg. open write stat rotate archive compress cleanup reopen format sink.write
+ * @param err error
+ *
+ */
+func (this *Flog ) handleError(op string, err error) {
+	this.queueError(op, err)
+	this.deliverErrors()
+}
+
+/**
+ * 记录内部错误,等解锁之后由deliverErrors交给ErrorHandler
+ * ErrorHandler中可能会写日志,持有锁时直接回调会死锁
+ */
+func (this *Flog ) queueError(op string, err error) {
+	if err == nil {
+		return
+	}
+	this.errMu.Lock()
+	defer this.errMu.Unlock()
+	this.lastErr = fmt.Errorf("flog: %s: %w", op, err)
+	this.metrics.countError(op)
+	if len(this.pendingErrs) < maxPendingErrors {
+		this.pendingErrs = append(this.pendingErrs, pendingError{op:op, err:err})
+		atomic.StoreInt32(&this.errPending, 1)
+	}
+}
+
+/**
+ * 把记录的错误交给ErrorHandler,不能持有锁
+ * 同时只有一个goroutine回调,回调期间产生的错误(其他goroutine的或者ErrorHandler中写日志产生的)
+ * 等errorRetryDelay之后再回调,避免递归,ErrorHandler中写日志一直出错时也不会占满CPU
+ */
+func (this *Flog ) deliverErrors() {
+	if atomic.LoadInt32(&this.errPending) == 0 {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&this.delivering, 0, 1) {
+		return
+	}
+	defer func() {
+		atomic.StoreInt32(&this.delivering, 0)
+		if atomic.LoadInt32(&this.errPending) == 1 {
+			time.AfterFunc(errorRetryDelay, this.deliverErrors)
+		}
+	}()
+	this.errMu.Lock()
+	errs := this.pendingErrs
+	this.pendingErrs = nil
+	atomic.StoreInt32(&this.errPending, 0)
+	this.errMu.Unlock()
+
+	for _, e := range errs {
+		if this.ErrorHandler != nil {
+			this.ErrorHandler(e.op, e.err)
+			continue
+		}
+		log.Println("flog:", e.op, e.err)
+	}
+}
+
+//最后一次内部错误,没有错误时返回nil
+func (this *Flog ) Err() error {
+	this.errMu.Lock()
+	defer this.errMu.Unlock()
+	return this.lastErr
+}
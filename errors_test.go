@@ -0,0 +1,87 @@
+package flog
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+//测试内部错误的回调和Err
+func TestErrorHandler(t *testing.T) {
+	loger := New("/tmp/flog_error")
+	defer os.RemoveAll(loger.LogPath)
+	var ops []string
+	loger.ErrorHandler = func(op string, err error) {
+		ops = append(ops, op)
+	}
+	if loger.Err() != nil {
+		t.Fatal("Err should be nil before any failure")
+	}
+	//日志目录是一个文件,打开日志文件会失败
+	os.WriteFile(loger.LogPath, []byte("x"), 0644)
+	loger.Debug("d", "debug_message")
+	if len(ops) != 1 || ops[0] != "open" {
+		t.Fatal("ErrorHandler was not called as expected.", ops)
+	}
+	if loger.Err() == nil {
+		t.Fatal("Err should report the last failure")
+	}
+	os.Remove(loger.LogPath)
+
+	loger.Close()
+	loger.Debug("d", "after close")
+	if !errors.Is(loger.Err(), ErrClosed) || ops[len(ops) - 1] != "log" {
+		t.Fatal("Logging after close should report ErrClosed,", loger.Err())
+	}
+	if FileExist(path.Join(loger.LogPath, loger.FileName)) {
+		t.Fatal("Logs after close should be dropped")
+	}
+}
+
+//测试ErrorHandler中写日志不会死锁,关闭之后只报告一次ErrClosed
+func TestErrorHandlerLogs(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		loger := New("/tmp/flog_error_logs")
+		os.RemoveAll(loger.LogPath)
+		var mu sync.Mutex
+		ops := make(map[string]int)
+		loger.ErrorHandler = func(op string, err error) {
+			mu.Lock()
+			ops[op]++
+			mu.Unlock()
+			loger.Error("flog", op, err)
+		}
+		if async {
+			loger.SetAsync(2)
+		}
+		//日志目录是一个文件,每次写入都会失败
+		os.WriteFile(loger.LogPath, []byte("x"), 0644)
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 20; i++ {
+				loger.Debug("d", "debug_message")
+			}
+			loger.Close()
+			for i := 0; i < 3; i++ {
+				loger.Debug("d", "after close")
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Logging in ErrorHandler deadlocked, async:", async)
+		}
+		os.Remove(loger.LogPath)
+		//其他goroutine正在回调时产生的错误稍后回调
+		time.Sleep(3 * errorRetryDelay)
+		mu.Lock()
+		if ops["open"] == 0 || ops["log"] != 1 {
+			t.Fatal("Errors were not reported as expected.", async, ops)
+		}
+		mu.Unlock()
+	}
+}
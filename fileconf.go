@@ -0,0 +1,62 @@
+package flog
+
+import (
+	"path"
+	"path/filepath"
+)
+
+/**
+ * 归档,压缩和清理等后台任务使用的配置快照
+ * 在持有锁的时候创建,执行期间重新加载配置不会影响正在执行的后台任务
+ */
+type fileConf struct {
+	logPath         string
+	archivePath     string
+	dateFormat      string
+	needArchive     bool
+	multiProcess    bool
+	rotateKeepExt   bool
+	logKeepDay      int
+	logKeepCount    int
+	logMaxTotalSize int
+	compressor      Compressor
+}
+
+//创建后台任务使用的配置快照,需要持有锁
+func (this *Flog ) fileConf() *fileConf {
+	return &fileConf{
+		logPath:this.LogPath,
+		archivePath:this.ArchivePath,
+		dateFormat:this.DateFormat,
+		needArchive:this.NeedArchive,
+		multiProcess:this.MultiProcess,
+		rotateKeepExt:this.LogRotateKeepExt,
+		logKeepDay:this.LogKeepDay,
+		logKeepCount:this.LogKeepCount,
+		logMaxTotalSize:this.LogMaxTotalSize,
+		compressor:this.LogCompress,
+	}
+}
+
+//加锁创建配置快照,不能持有锁
+func (this *Flog ) loadFileConf() *fileConf {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.fileConf()
+}
+
+//压缩文件的扩展名,未开启压缩时为空
+func (this *fileConf ) compressExt() string {
+	if this.compressor == nil {
+		return ""
+	}
+	return this.compressor.Ext()
+}
+
+//归档目录
+func (this *fileConf ) archiveDir() string {
+	if filepath.IsAbs(this.archivePath) {
+		return this.archivePath
+	}
+	return path.Join(this.logPath, this.archivePath)
+}
@@ -1,6 +1,8 @@
 package flog
 
 import (
+	"bufio"
+	"context"
 	"sync"
 	"log"
 	"os"
@@ -10,24 +12,43 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"io/ioutil"
-	"path/filepath"
 )
 
 const (
-	LEVEL_DEBUG = iota
+	LEVEL_TRACE = iota - 1        //比debug更详细的诊断日志,默认不输出
+	LEVEL_DEBUG
 	LEVEL_INFO
 	LEVEL_WARNING
 	LEVEL_ERROR
+	LEVEL_PANIC                    //写完日志之后panic
+	LEVEL_FATAL                    //写完日志并关闭之后退出进程
 )
 
 var levels = map[int]string{
+	LEVEL_TRACE:"trace",
 	LEVEL_DEBUG:"debug",
 	LEVEL_INFO:"info",
 	LEVEL_WARNING:"warning",
 	LEVEL_ERROR:"error",
+	LEVEL_PANIC:"panic",
+	LEVEL_FATAL:"fatal",
 }
 
+//命令行日志每个等级的颜色
+var levelColors = map[int]string{
+	LEVEL_TRACE:"\033[90m",
+	LEVEL_INFO:"\033[32m",
+	LEVEL_WARNING:"\033[33m",
+	LEVEL_ERROR:"\033[31m",
+	LEVEL_PANIC:"\033[35m",
+	LEVEL_FATAL:"\033[35m",
+}
+
+//Fatal退出进程的函数,测试时替换
+var exitFunc = os.Exit
+
 //文件名模式
 const (
 	LOGMODE_FILE = iota        //以FileName做文件名
@@ -45,13 +66,86 @@ const (
 	LF_LEVEL                    //输出等级
 )
 
+//异步队列满时的处理方式
+const (
+	OVERFLOW_BLOCK = iota                //阻塞等待
+	OVERFLOW_BLOCK_TIMEOUT                //阻塞等待OverflowTimeout毫秒,超时丢弃
+	OVERFLOW_DROP_NEWEST                  //丢弃当前的消息
+	OVERFLOW_DROP_OLDEST                  //丢弃队列中最早的消息
+	OVERFLOW_DROP_BELOW_LEVEL             //丢弃低于OverflowLevel的消息,其他的阻塞等待
+)
+
+//按时间切割的常用间隔,单位分钟
+const (
+	ROTATE_HOURLY = 60
+	ROTATE_DAILY = 24 * 60
+)
+
+//切割文件的命名方式
+const (
+	ROTATENAME_TIME = iota        //以时间做后缀,重名时再加序号 eg. app.log.1530 app.log.1530.1
+	ROTATENAME_SEQ                //以递增的序号做后缀 eg. app.log.1 app.log.2
+)
+
+//日志行格式
+const (
+	LOGFORMAT_TEXT = iota        //按LogFlags和LogFlagSeparator拼接的文本
+	LOGFORMAT_JSON                //每行一个json对象
+)
+
 //日志结构体
 type LogMsg struct {
-	logTime   time.Time
-	level     int    //日志等级
-	category  string //日志分类
-	message   string //日志内容
-	formatMsg string //格式化之后的内容
+	Time      time.Time
+	Level     int     //日志等级
+	Category  string  //日志分类
+	Message   string  //日志内容
+	Fields    []Field //结构化字段
+	File      string  //调用日志的文件
+	Line      int     //调用日志的行号
+	formatMsg string  //格式化之后的内容
+}
+
+//结构化日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+//构造一个结构化字段 eg. flog.F("uid", 1001)
+func F(key string, value interface{}) Field {
+	return Field{Key:key, Value:value}
+}
+
+/**
+ * 把 key,value,key,value... 形式的参数转换为字段列表
+ * 参数中也可以直接传入Field,缺少value的key会被记为 !MISSING
+ *
+ * @param keysAndValues []interface{}
+ * @return []Field
+ *
+ */
+func toFields(keysAndValues []interface{}) []Field {
+	if len(keysAndValues) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, len(keysAndValues) / 2 + 1)
+	for i := 0; i < len(keysAndValues); i++ {
+		if f, ok := keysAndValues[i].(Field); ok {
+			fields = append(fields, f)
+			continue
+		}
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		if i + 1 >= len(keysAndValues) {
+			fields = append(fields, Field{Key:key, Value:"!MISSING"})
+			break
+		}
+		i++
+		fields = append(fields, Field{Key:key, Value:keysAndValues[i]})
+	}
+	return fields
 }
 
 //用来格式化时间
@@ -111,6 +205,10 @@ func FileExist(filename string) bool {
 type Flog struct {
 	mu               sync.Mutex
 	Level            int                    //日志等级
+	confMu           sync.Mutex             //修改配置时持有
+	configWatch      chan struct{}          //停止检查配置文件
+	level            atomic.Value           //int SetLevel设置的全局等级,设置之后代替Level
+	categoryLevels   atomic.Value           //map[string]int 分类的日志等级,写时复制
 	LogMode          int                    //日志文件名模式
 	LogPath          string                 //日志文件的根目录
 	FileName         string                 //文件名
@@ -118,29 +216,77 @@ type Flog struct {
 	LogFlags         []int                  //日志输出的格式以及顺序
 	LogFlagSeparator string                 //日志输出的分隔符
 	LogFunCallDepth  int                    //获取调用函数的层级
+	LogFormat        int                    //日志行格式 LOGFORMAT_TEXT 或 LOGFORMAT_JSON
+	Formatter        Formatter              //自定义文件日志的格式,设置后忽略LogFormat LogFlags LogFlagSeparator
+	ConsoleFormatter Formatter              //自定义命令行日志的格式,默认与文件一致
 											/**
 											 * 日志logger相关
 											 */
 	logerMap         map[string]*log.Logger //filename:log.Logger
 	fhMap            map[string]*os.File    //filename:os.File
+	fileTimeMap      map[string]time.Time   //filename:文件所属周期的开始时间
+	checkTimeMap     map[string]time.Time   //filename:上次检查文件是否被删除或移动的时间
+	bufMap           map[string]*bufio.Writer //filename:异步模式下的写缓冲
+	sizeMap          map[string]int64       //filename:带缓冲时记录的文件大小
+	infoMap          map[string]os.FileInfo //filename:最近一次stat的文件信息,多进程时用来判断文件是否被切割
+	logNames         map[string]bool        //写过的不带日期后缀的日志名
 											/**
 											 * 异步写相关
 											 */
 	msgChan          chan *LogMsg           //日志chan
-	signalChan       chan string            //信号chan 包括flush 和 close
+	signalChan       chan *flushSignal      //信号chan 包括flush 和 close
 	async            bool                   //是否开启异步
-	wg               sync.WaitGroup
+	OverflowPolicy   int                    //异步队列满时的处理方式 OVERFLOW_*,默认阻塞
+	OverflowTimeout  int                    //OVERFLOW_BLOCK_TIMEOUT 时最长等待的时间,单位毫秒,默认100
+	OverflowLevel    int                    //OVERFLOW_DROP_BELOW_LEVEL 时低于该等级的消息直接丢弃,其他的阻塞等待
+	DropReportInterval int                  //把丢弃的消息数写入日志的间隔,单位秒,默认60
+	dropped          int64                  //丢弃的消息总数
+	reportedDropped  int64                  //已经写入日志的丢弃数
+	lastDropReport   time.Time              //上次写入丢弃数的时间
+	AsyncBufferSize  int                    //异步模式下每个文件的写缓冲大小,单位KB,默认64,-1表示不缓冲
+	AsyncFlushInterval int                  //异步模式下写缓冲的刷新间隔,单位毫秒,默认200
+	closeMu          sync.RWMutex           //写日志时持有读锁,关闭时持有写锁
+	closed           bool                   //是否已经关闭
+	closeOnce        sync.Once
+	closeDone        chan struct{}          //关闭完成
 
 											/**
 											 * 日志切割和归档相关
 											 */
 	LogRotateSize    int                    //日志切割的文件大小最大值,单位KB
+	LogRotateInterval int                   //按时间切割的间隔,单位分钟,按整点对齐,eg. ROTATE_HOURLY ROTATE_DAILY
+	LogRotateNaming  int                    //切割文件的命名方式 ROTATENAME_TIME 或 ROTATENAME_SEQ
+	LogRotateKeepExt bool                   //切割文件是否保留扩展名在最后,eg. app.20160410.1.log
+	LogCompress      Compressor             //切割和归档之后的文件压缩方式,eg. &GzipCompressor{},默认不压缩
+	compressing      sync.Map               //正在压缩的文件
 	NeedArchive      bool                   //是否需要归档
 	ArchivePath      string                 //归档目录 default:archive
 	LogKeepDay       int                    //归档日志保留天数,默认7天
-	lastArchiveDay   string                 //上次清理的日期
+	lastArchiveDay   string                 //上次归档成功的日期
+	archiveRetryAt   time.Time              //归档失败之后下次重试的时间
+	archiving        int32                  //是否正在归档
+	LogKeepCount     int                    //每个日志最多保留的切割文件数(包括归档的),0表示不限制
+	LogMaxTotalSize  int                    //LogPath和归档目录下所有日志的总大小上限,单位MB,0表示不限制
+	cleaning         int32                  //是否正在清理
 
 	OpenConsoleLog   bool                   //是否打印在控制台
+	ErrorHandler     func(op string, err error) //内部错误的回调,op为出错的操作 eg. write rotate archive,默认输出到标准错误
+	errMu            sync.Mutex
+	lastErr          error                  //最后一次内部错误
+	pendingErrs      []pendingError         //持有锁时产生的错误,解锁之后再交给ErrorHandler
+	errPending       int32                  //是否有等待回调的错误
+	delivering       int32                  //是否正在回调ErrorHandler
+	closedReported   int32                  //是否已经报告过关闭之后写日志
+	metrics          metrics                //统计数据
+	reopenSignal     chan os.Signal         //触发重新打开文件的信号
+	MultiProcess     bool                   //是否有多个进程写同一个文件,开启后切割和归档加文件锁,其他进程切割之后自动重新打开
+	LogCheckInterval int                    //检查文件是否被删除或移动的间隔,单位毫秒,默认1000,-1表示不检查
+
+											/**
+											 * 输出目标相关
+											 */
+	DisableFileLog   bool                   //是否关闭内置的文件输出,只输出到AddSink添加的目标
+	sinks            atomic.Value           //[]Sink 输出目标,第一个为内置的文件输出,写时复制
 }
 
 /**
@@ -161,9 +307,20 @@ func New(logPath ...string) *Flog {
 
 func (this *Flog ) init() {
 	//对文件操作的map和日志处理map初始化
-	if len(this.fhMap) == 0 {
+	if this.fhMap == nil {
 		this.fhMap = make(map[string]*os.File)
 		this.logerMap = make(map[string]*log.Logger)
+		this.fileTimeMap = make(map[string]time.Time)
+		this.checkTimeMap = make(map[string]time.Time)
+		this.bufMap = make(map[string]*bufio.Writer)
+		this.sizeMap = make(map[string]int64)
+		this.infoMap = make(map[string]os.FileInfo)
+	}
+	if this.logNames == nil {
+		this.logNames = make(map[string]bool)
+	}
+	if this.getSinks() == nil {
+		this.sinks.Store([]Sink{&fileSink{flog:this}})
 	}
 	if len(this.LogPath) == 0 {
 		this.LogPath = "logs"
@@ -177,10 +334,6 @@ func (this *Flog ) init() {
 		this.FileName = "flog.log"
 	}
 
-	if this.LogMode == 0 {
-		this.LogMode = LOGMODE_FILE
-	}
-
 	if this.LogFunCallDepth == 0 {
 		this.LogFunCallDepth = 3
 	}
@@ -189,6 +342,10 @@ func (this *Flog ) init() {
 		this.LogFlags = []int{LF_DATETIME, LF_LONGFILE, LF_CATE, LF_LEVEL}
 	}
 
+	if len(this.LogFlagSeparator) == 0 {
+		this.LogFlagSeparator = " "
+	}
+
 	if this.LogRotateSize == 0 {
 		this.LogRotateSize = 100 << 10  //100M
 	}
@@ -196,6 +353,10 @@ func (this *Flog ) init() {
 	if this.LogKeepDay == 0 {
 		this.LogKeepDay = 7        //7 天
 	}
+
+	if this.LogCheckInterval == 0 {
+		this.LogCheckInterval = 1000        //1秒
+	}
 }
 
 /**
@@ -213,28 +374,43 @@ func (this *Flog ) SetAsync(capacity int64) *Flog {
 	}
 	//初始化chan
 	this.msgChan = make(chan *LogMsg, capacity)
-	this.signalChan = make(chan string, 1)
+	this.signalChan = make(chan *flushSignal, 1)
 	//异步执行日志收集
-	this.wg.Add(1)
 	go this.collect()
 	return this
 }
 
 func (this *Flog ) collect() {
 	over := false
+	//定时刷新写缓冲,并把丢弃的消息数写入日志
+	interval := this.AsyncFlushInterval
+	if interval <= 0 {
+		interval = 200
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
 
 	for {
 		select {
 		//写入
 		case msg := <-this.msgChan:
-			this.writeMsg(msg)
+			this.dispatch(msg)
+			this.deliverErrorsAsync()
+		case <-ticker.C:
+			if err := this.flushBuffers(); err != nil {
+				this.queueError("flush", err)
+			}
+			this.reportDropped(false)
+			this.deliverErrorsAsync()
 		//接受flush 和 close 两个信号
 		case signal := <-this.signalChan:
 			this.flush()
-			if signal == "close" {
+			this.reportDropped(signal.kind == "close")
+			this.flushSinks()
+			if signal.kind == "close" {
 				over = true
 			}
-			this.wg.Done()
+			close(signal.done)
 		}
 		if over {
 			break
@@ -247,74 +423,207 @@ func (this *Flog ) flush() {
 	for {
 		if len(this.msgChan) > 0 {
 			msg := <-this.msgChan
-			this.writeMsg(msg)
+			this.dispatch(msg)
 			continue
 		}
 		break
 	}
 }
 
-//关闭日志并清空缓冲区消息
-func (this *Flog ) Close() {
-	if this.async {
-		this.signalChan <- "close"
-		//等待执行完成
-		this.wg.Wait()
-		close(this.msgChan)
-		close(this.signalChan)
-	}else {
-		this.flush()
+//在collect中产生的错误交给其他goroutine回调,ErrorHandler中写日志时队列满了会阻塞collect
+//flush和close产生的错误由调用Flush和Close的goroutine回调
+func (this *Flog ) deliverErrorsAsync() {
+	if atomic.LoadInt32(&this.errPending) == 1 {
+		go this.deliverErrors()
 	}
-	this.fhMap = nil
-	this.logerMap = nil
+}
+
+//关闭日志并清空缓冲区消息,可以重复调用
+func (this *Flog ) Close() {
+	this.CloseContext(context.Background())
 }
 
 //清空缓冲区消息
 func (this *Flog ) Flush() {
-	if this.async {
-		this.signalChan <- "flush"
-		this.wg.Wait()
-		this.wg.Add(1)
-		return
+	this.FlushContext(context.Background())
+}
+
+func (this *Flog ) Trace(category string, v ...interface{}) {
+	if this.enabled(category, LEVEL_TRACE) {
+		this.log(category, LEVEL_TRACE, fmt.Sprintln(v...), nil)
 	}
-	this.flush()
 }
 
 func (this *Flog ) Debug(category string, v ...interface{}) {
-	if LEVEL_DEBUG >= this.Level {
-		this.log(category, LEVEL_DEBUG, v...)
+	if this.enabled(category, LEVEL_DEBUG) {
+		this.log(category, LEVEL_DEBUG, fmt.Sprintln(v...), nil)
 	}
 }
 
 func (this *Flog ) Info(category string, v ...interface{}) {
-	if LEVEL_INFO >= this.Level {
-		this.log(category, LEVEL_INFO, v...)
+	if this.enabled(category, LEVEL_INFO) {
+		this.log(category, LEVEL_INFO, fmt.Sprintln(v...), nil)
 	}
 }
 
 func (this *Flog ) Warning(category string, v ...interface{}) {
-	if LEVEL_WARNING >= this.Level {
-		this.log(category, LEVEL_WARNING, v...)
+	if this.enabled(category, LEVEL_WARNING) {
+		this.log(category, LEVEL_WARNING, fmt.Sprintln(v...), nil)
 	}
 }
 
 func (this *Flog ) Error(category string, v ...interface{}) {
-	if LEVEL_ERROR >= this.Level {
-		this.log(category, LEVEL_ERROR, v...)
+	if this.enabled(category, LEVEL_ERROR) {
+		this.log(category, LEVEL_ERROR, fmt.Sprintln(v...), nil)
+	}
+}
+
+//写日志并把所有日志写入之后panic,panic的值为日志内容
+func (this *Flog ) Panic(category string, v ...interface{}) {
+	message := fmt.Sprintln(v...)
+	if this.enabled(category, LEVEL_PANIC) {
+		this.log(category, LEVEL_PANIC, message, nil)
+	}
+	this.Flush()
+	panic(strings.TrimSuffix(message, "\n"))
+}
+
+//写日志并关闭日志之后退出进程,退出码为1
+func (this *Flog ) Fatal(category string, v ...interface{}) {
+	if this.enabled(category, LEVEL_FATAL) {
+		this.log(category, LEVEL_FATAL, fmt.Sprintln(v...), nil)
 	}
+	this.Close()
+	exitFunc(1)
 }
 
-func (this *Flog ) log(category string, level int, v ...interface{}) {
+/**
+ * 结构化日志,msg之后的参数为 key,value 对或者 Field
+ * eg. loger.Infow("http", "request done", "uid", 1001, "cost", time.Since(start))
+ */
+func (this *Flog ) Tracew(category string, msg string, keysAndValues ...interface{}) {
+	if this.enabled(category, LEVEL_TRACE) {
+		this.log(category, LEVEL_TRACE, msg, toFields(keysAndValues))
+	}
+}
+
+func (this *Flog ) Debugw(category string, msg string, keysAndValues ...interface{}) {
+	if this.enabled(category, LEVEL_DEBUG) {
+		this.log(category, LEVEL_DEBUG, msg, toFields(keysAndValues))
+	}
+}
+
+func (this *Flog ) Infow(category string, msg string, keysAndValues ...interface{}) {
+	if this.enabled(category, LEVEL_INFO) {
+		this.log(category, LEVEL_INFO, msg, toFields(keysAndValues))
+	}
+}
+
+func (this *Flog ) Warningw(category string, msg string, keysAndValues ...interface{}) {
+	if this.enabled(category, LEVEL_WARNING) {
+		this.log(category, LEVEL_WARNING, msg, toFields(keysAndValues))
+	}
+}
+
+func (this *Flog ) Errorw(category string, msg string, keysAndValues ...interface{}) {
+	if this.enabled(category, LEVEL_ERROR) {
+		this.log(category, LEVEL_ERROR, msg, toFields(keysAndValues))
+	}
+}
+
+func (this *Flog ) Panicw(category string, msg string, keysAndValues ...interface{}) {
+	if this.enabled(category, LEVEL_PANIC) {
+		this.log(category, LEVEL_PANIC, msg, toFields(keysAndValues))
+	}
+	this.Flush()
+	panic(msg)
+}
+
+func (this *Flog ) Fatalw(category string, msg string, keysAndValues ...interface{}) {
+	if this.enabled(category, LEVEL_FATAL) {
+		this.log(category, LEVEL_FATAL, msg, toFields(keysAndValues))
+	}
+	this.Close()
+	exitFunc(1)
+}
+
+/**
+ * 格式化日志,与fmt.Printf的用法一致,不会在参数之间加空格
+ * eg. loger.Infof("http", "%s %d %v", path, status, time.Since(start))
+ */
+func (this *Flog ) Tracef(category string, format string, v ...interface{}) {
+	if this.enabled(category, LEVEL_TRACE) {
+		this.log(category, LEVEL_TRACE, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (this *Flog ) Debugf(category string, format string, v ...interface{}) {
+	if this.enabled(category, LEVEL_DEBUG) {
+		this.log(category, LEVEL_DEBUG, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (this *Flog ) Infof(category string, format string, v ...interface{}) {
+	if this.enabled(category, LEVEL_INFO) {
+		this.log(category, LEVEL_INFO, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (this *Flog ) Warningf(category string, format string, v ...interface{}) {
+	if this.enabled(category, LEVEL_WARNING) {
+		this.log(category, LEVEL_WARNING, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (this *Flog ) Errorf(category string, format string, v ...interface{}) {
+	if this.enabled(category, LEVEL_ERROR) {
+		this.log(category, LEVEL_ERROR, fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (this *Flog ) Panicf(category string, format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	if this.enabled(category, LEVEL_PANIC) {
+		this.log(category, LEVEL_PANIC, message, nil)
+	}
+	this.Flush()
+	panic(message)
+}
+
+func (this *Flog ) Fatalf(category string, format string, v ...interface{}) {
+	if this.enabled(category, LEVEL_FATAL) {
+		this.log(category, LEVEL_FATAL, fmt.Sprintf(format, v...), nil)
+	}
+	this.Close()
+	exitFunc(1)
+}
+
+func (this *Flog ) log(category string, level int, message string, fields []Field) {
+	//解锁之后再回调ErrorHandler,ErrorHandler中可以写日志
+	defer this.deliverErrors()
+	//关闭之后不再接受日志
+	this.closeMu.RLock()
+	defer this.closeMu.RUnlock()
+	if this.closed {
+		//只报告一次,避免每次写日志都输出错误
+		if atomic.CompareAndSwapInt32(&this.closedReported, 0, 1) {
+			this.queueError("log", ErrClosed)
+		}
+		return
+	}
 	//执行初始化默认值
 	this.init()
+	this.metrics.countMsg(level, category)
 	msg := &LogMsg{
-		logTime:time.Now(),
-		level:level,
-		category:category,
-		message:fmt.Sprintln(v...),
+		Time:time.Now(),
+		Level:level,
+		Category:category,
+		Message:message,
+		Fields:fields,
 	}
+	msg.File, msg.Line = this.getCaller()
 	//格式化message
-	msg.formatMsg = this.formatMessage(msg)
+	msg.formatMsg = this.format(this.getFormatter(), msg)
 
 	if this.OpenConsoleLog {
 		this.write2console(msg)
@@ -322,9 +631,34 @@ func (this *Flog ) log(category string, level int, v ...interface{}) {
 
 	//如果是异步,先写入msgChan
 	if this.async {
-		this.msgChan <- msg
+		this.enqueue(msg)
 	}else {
-		this.writeMsg(msg)
+		this.dispatch(msg)
+	}
+}
+
+//把消息分发到所有的输出目标
+func (this *Flog ) dispatch(msg *LogMsg) {
+	for _, sink := range this.getSinks() {
+		if err := sink.Write(msg); err != nil {
+			this.queueError("sink.write", err)
+		}
+	}
+}
+
+func (this *Flog ) flushSinks() {
+	for _, sink := range this.getSinks() {
+		if err := sink.Flush(); err != nil {
+			this.queueError("sink.flush", err)
+		}
+	}
+}
+
+func (this *Flog ) closeSinks() {
+	for _, sink := range this.getSinks() {
+		if err := sink.Close(); err != nil {
+			this.queueError("sink.close", err)
+		}
 	}
 }
 
@@ -336,69 +670,87 @@ func (this *Flog ) writeMsg(msg *LogMsg) {
 	//fmt.Println(filename)
 	logger, err := this.getLogger(filename)
 	if err != nil {
-		fmt.Println("Error: fail to get logger by filename", filename, err)
+		this.metrics.countWriteFailed()
+		this.queueError("open", fmt.Errorf("fail to get logger by filename %s: %w", filename, err))
+		return
+	}
+	if err := logger.Output(2, msg.formatMsg); err != nil {
+		//缓冲出错之后会一直失败,需要重置
+		this.resetBuffer(filename)
+		this.metrics.countWriteFailed()
+		this.queueError("write", err)
 		return
 	}
-	logger.Print(msg.formatMsg)
+	//logger会在没有换行的日志后面加上换行
+	n := int64(len(msg.formatMsg))
+	if n == 0 || msg.formatMsg[n - 1] != '\n' {
+		n++
+	}
+	//按不带日期的日志名统计,避免每天增加新的key
+	this.metrics.countWrite(this.baseName(filename), n, time.Since(msg.Time))
+	if _, ok := this.bufMap[filename]; ok {
+		//带缓冲时记录文件大小,切割时不需要stat文件
+		this.sizeMap[filename] += n
+	}
 
-	//异步归档
+	//异步归档,每天归档成功一次,失败时隔一段时间重试,同时只有一个归档在执行
 	if this.NeedArchive {
-		//实现归档
-		go this.doArchive()
+		today := Date("Ymd")
+		if this.lastArchiveDay != today && time.Now().After(this.archiveRetryAt) &&
+			atomic.CompareAndSwapInt32(&this.archiving, 0, 1) {
+			//实现归档,使用当前配置的快照
+			go this.doArchive(this.fileConf(), today)
+		}
 	}
 }
 
 //日志同步写到控制台
 func (this *Flog ) write2console(msg *LogMsg) {
-	var code string
-	if msg.level == LEVEL_ERROR {
-		code = "\033[31m"
-	}else if msg.level == LEVEL_WARNING {
-		code = "\033[33m"
-	}else if msg.level == LEVEL_INFO {
-		code = "\033[32m"
-	}
-	logStr := "\033[0m" + code + msg.formatMsg + "\033[0m"
+	code := levelColors[msg.Level]
+	formatMsg := msg.formatMsg
+	if this.ConsoleFormatter != nil {
+		formatMsg = this.format(this.ConsoleFormatter, msg)
+	}
+	logStr := "\033[0m" + code + formatMsg + "\033[0m"
 	log.Println(logStr)
 }
 
-//格式化消息 日期 文件位置 等级 类别 消息
-func (this *Flog ) formatMessage(msg *LogMsg) string {
+//获取调用日志的文件和行号,与log同一层调用,保证LogFunCallDepth的含义不变
+func (this *Flog ) getCaller() (string, int) {
 	_, file, line, ok := runtime.Caller(this.LogFunCallDepth)
 	if !ok {
 		file = "???"
 		line = 0
 	}
-	formatStr := make([]interface{}, 0)
-	for _, flag := range this.LogFlags {
-		switch flag {
-		case LF_DATETIME:
-			formatStr = append(formatStr, msg.logTime.Format("2006-01-02 15:04:05"))
-		case LF_LEVEL:
-			formatStr = append(formatStr, strings.ToUpper(this.getLevelName(msg.level)))
-		case LF_CATE:
-			formatStr = append(formatStr, msg.category)
-		case LF_LONGFILE:
-			formatStr = append(formatStr, file + ":" + strconv.Itoa(line))
-		case LF_SHORTFILE:
-			short := file
-			for i := len(file) - 1; i > 0; i-- {
-				if file[i] == '/' {
-					short = file[i + 1:]
-					break
-				}
+	return file, line
+}
+
+//获取写文件用的formatter,未设置时根据 LogFormat LogFlags LogFlagSeparator 生成默认的
+func (this *Flog ) getFormatter() Formatter {
+	if this.Formatter != nil {
+		return this.Formatter
+	}
+	if this.LogFormat == LOGFORMAT_JSON {
+		shortFile := false
+		for _, flag := range this.LogFlags {
+			if flag == LF_SHORTFILE {
+				shortFile = true
+				break
 			}
-			formatStr = append(formatStr, short + ":" + strconv.Itoa(line))
 		}
+		return &JSONFormatter{ShortFile:shortFile}
 	}
-	formatStr = append(formatStr, msg.message)
+	return &TextFormatter{Flags:this.LogFlags, Separator:this.LogFlagSeparator}
+}
 
-	if len(this.LogFlagSeparator) == 0 {
-		this.LogFlagSeparator = " "
+//使用formatter格式化消息,格式化失败时退回原始消息
+func (this *Flog ) format(formatter Formatter, msg *LogMsg) string {
+	b, err := formatter.Format(msg)
+	if err != nil {
+		this.queueError("format", err)
+		return msg.Message
 	}
-
-	s := strings.TrimPrefix(strings.Repeat(this.LogFlagSeparator + "%s", len(formatStr)), this.LogFlagSeparator)
-	return fmt.Sprintf(s, formatStr...)
+	return string(b)
 }
 
 //根据等级获取等级的label
@@ -406,22 +758,29 @@ func (this *Flog ) getLevelName(level int) string {
 	return levels[level]
 }
 
+//根据等级获取等级的label,供自定义的Formatter使用
+func LevelName(level int) string {
+	return levels[level]
+}
+
 //根据消息获取文件名
 func (this *Flog ) getFilename(msg *LogMsg) string {
 	filename := ""
-	levelName := this.getLevelName(msg.level)
+	levelName := this.getLevelName(msg.Level)
 	switch this.LogMode {
 	case LOGMODE_FILE:
 		filename = this.FileName
 	case LOGMODE_FILE_LEVEL:
 		filename = this.FileName + "." + levelName
 	case LOGMODE_CATE:
-		filename = msg.category
+		filename = msg.Category
 	case LOGMODE_CATE_LEVEL:
-		filename = msg.category + "." + levelName
+		filename = msg.Category + "." + levelName
 	default:
 		filename = this.FileName
 	}
+	//记录不带日期的日志名,清理时用来区分每个日志的切割文件
+	this.logNames[filename] = true
 	if len(this.DateFormat) > 0 {
 		nowDate := Date(this.DateFormat)
 		//nowDate := time.Now().Format(this.DateFormat)
@@ -441,19 +800,26 @@ func (this *Flog ) getLogger(filename string) (*log.Logger, error) {
 
 	//先去fhMap里面查看
 	fh, ok := this.fhMap[filename]
+	//文件被删除,移动或者被其他进程切割了,需要重新打开
+	if ok && fh != nil && this.needReopen(filename, fh, filePath) {
+		ok = false
+	}
 	if !ok || (fh != nil && fh.Name() != filePath) {
 		if fh != nil {
+			if err := this.flushBuffer(filename); err != nil {
+				this.queueError("flush", err)
+			}
 			fh.Close()
 		}
 		err := this.createFileHandleAndFlogger(filename, filePath)
 		if err != nil {
 			return nil, err
 		}
-	}else {
-		err := this.rotate(fh)
-		if err != nil {
-			return nil, err
-		}
+		fh = this.fhMap[filename]
+	}
+	err := this.rotate(filename, fh)
+	if err != nil {
+		return nil, err
 	}
 	//@todo check logger exist
 	logger := this.logerMap[filename]
@@ -462,42 +828,84 @@ func (this *Flog ) getLogger(filename string) (*log.Logger, error) {
 }
 
 //执行切割
-func (this *Flog ) rotate(file *os.File) error {
-	//如果不需要切割
-	if !this.needRotate(file) {
+func (this *Flog ) rotate(filename string, file *os.File) error {
+	var suffix string
+	if start, ok := this.needRotateByTime(filename); ok {
+		//按时间切割时,以文件所属周期的开始时间做后缀
+		suffix = Date(this.rotateTimeFormat(), start.Unix())
+	}else if this.needRotate(filename, file) {
+		suffix = Date("Hin")
+	}else {
+		//如果不需要切割
 		return nil
 	}
-	//先关闭
-	err := file.Close()
-	if err != nil {
-		return err
-	}
 	filePath := file.Name()
-	_, filename := path.Split(filePath)
-	//再重命名
-	newPath := filePath + "." + Date("Hin")
+	//多进程时加锁,拿到锁之后如果文件已经被其他进程切割,只需要重新打开
+	if this.MultiProcess {
+		unlock, err := lockFile(this.lockPath(filename), true)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if !this.sameFile(filename, file, filePath) {
+			if err := this.flushBuffer(filename); err != nil {
+				this.queueError("flush", err)
+			}
+			file.Close()
+			return this.createFileHandleAndFlogger(filename, filePath)
+		}
+	}
+	//先把缓冲写完再关闭,缓冲中的日志属于切割之前的文件
+	if err := this.flushBuffer(filename); err != nil {
+		this.queueError("flush", err)
+	}
+	if err := file.Close(); err != nil {
+		this.queueError("rotate", err)
+	}
 	//再次判断是否存在,防止多个进程同时操作一个文件
 	if !FileExist(filePath) {
 		//创建新的
 		return this.createFileHandleAndFlogger(filename, filePath)
 	}
-	os.Rename(filePath, newPath)
+	//再重命名
+	newPath, err := this.renameRotated(filePath, suffix)
+	if err != nil {
+		//重命名失败时继续写原来的文件
+		this.queueError("rotate", err)
+	}else {
+		atomic.AddInt64(&this.metrics.rotations, 1)
+		if this.LogCompress != nil {
+			//后台压缩
+			go this.compressFileAndReport(this.fileConf(), newPath)
+		}
+	}
+	if this.LogKeepCount > 0 || this.LogMaxTotalSize > 0 {
+		go this.cleanup(this.fileConf())
+	}
 	//创建新的
 	return this.createFileHandleAndFlogger(filename, filePath)
 }
 
 //是否需要切割日志
-func (this *Flog ) needRotate(file *os.File) bool {
+func (this *Flog ) needRotate(filename string, file *os.File) bool {
 	//如果日志切割大小为-1 则不切割
 	if this.LogRotateSize <= 0 {
 		return false
 	}
 
-	//获取文件的大小
-	info, err := file.Stat()
-	if err != nil {
-		log.Println("get file stat err,", file.Name(), err)
-		return false
+	//带缓冲时使用记录的文件大小
+	if _, ok := this.bufMap[filename]; ok {
+		return this.sizeMap[filename] >= int64(this.LogRotateSize << 10)
+	}
+
+	//多进程时每次写入前都stat过路径,直接使用记录的大小
+	info, ok := this.infoMap[filename]
+	if !this.MultiProcess || !ok {
+		var err error
+		if info, err = file.Stat(); err != nil {
+			this.queueError("stat", err)
+			return false
+		}
 	}
 	if info.Size() >= int64(this.LogRotateSize << 10) {
 		return true
@@ -506,6 +914,136 @@ func (this *Flog ) needRotate(file *os.File) bool {
 	return false
 }
 
+/**
+ * 把切割的文件重命名为不重复的名字,已存在的文件不会被覆盖
+ * ROTATENAME_TIME 为 app.log.<suffix>,重名时为 app.log.<suffix>.1 app.log.<suffix>.2 ...
+ * ROTATENAME_SEQ 为 app.log.1 app.log.2 ...,序号依次递增
+ * LogRotateKeepExt 为true时扩展名放在最后,eg. app.<suffix>.1.log
+ *
+ * @param filePath string 当前写入的文件
+ * @param suffix string 时间后缀
+ * @return string, error 重命名之后的文件
+ *
+ */
+func (this *Flog ) renameRotated(filePath, suffix string) (string, error) {
+	dir, name := path.Split(filePath)
+	ext := ""
+	if this.LogRotateKeepExt {
+		ext = path.Ext(name)
+		name = strings.TrimSuffix(name, ext)
+	}
+	seq := 0
+	if this.LogRotateNaming == ROTATENAME_SEQ {
+		suffix = ""
+		seq = maxRotateSeq(dir, name, ext, this.compressExt()) + 1
+	}
+	for {
+		newName := name
+		if len(suffix) > 0 {
+			newName += "." + suffix
+		}
+		if seq > 0 {
+			newName += "." + strconv.Itoa(seq)
+		}
+		newPath := path.Join(dir, newName + ext)
+		//压缩之后的文件也不能重名
+		if cext := this.compressExt(); len(cext) > 0 && FileExist(newPath + cext) {
+			seq++
+			continue
+		}
+		err := renameNoReplace(filePath, newPath)
+		if err == nil {
+			return newPath, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		seq++
+	}
+}
+
+//获取已切割文件的最大序号,eg. app.log.3 app.3.log app.log.3.gz
+func maxRotateSeq(dir, name, ext, compressExt string) int {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	max := 0
+	for _, f := range files {
+		s := f.Name()
+		if len(compressExt) > 0 {
+			s = strings.TrimSuffix(s, compressExt)
+		}
+		if !strings.HasPrefix(s, name + ".") || !strings.HasSuffix(s, ext) || len(s) <= len(name) + 1 + len(ext) {
+			continue
+		}
+		n, err := strconv.Atoi(s[len(name) + 1:len(s) - len(ext)])
+		if err == nil && n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+//重命名文件,目标已存在时返回os.ErrExist,不会覆盖
+func renameNoReplace(oldPath, newPath string) error {
+	//先硬链接再删除,链接在目标存在时会失败,保证不会覆盖
+	err := os.Link(oldPath, newPath)
+	if err == nil {
+		return os.Remove(oldPath)
+	}
+	if os.IsExist(err) {
+		return err
+	}
+	//文件系统不支持硬链接时退回到先判断再重命名
+	if FileExist(newPath) {
+		return os.ErrExist
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+//是否需要按时间切割,返回文件所属周期的开始时间
+func (this *Flog ) needRotateByTime(filename string) (time.Time, bool) {
+	if this.LogRotateInterval <= 0 {
+		return time.Time{}, false
+	}
+	start, ok := this.fileTimeMap[filename]
+	if !ok {
+		return start, false
+	}
+	return start, rotatePeriodStart(time.Now(), this.LogRotateInterval).After(start)
+}
+
+//按时间切割的文件后缀格式,按天切割为Ymd,按小时为YmdH,其他为YmdHi
+func (this *Flog ) rotateTimeFormat() string {
+	if this.LogRotateInterval % ROTATE_DAILY == 0 {
+		return "Ymd"
+	}
+	if this.LogRotateInterval % ROTATE_HOURLY == 0 {
+		return "YmdH"
+	}
+	return "YmdHi"
+}
+
+/**
+ * 计算时间所在周期的开始时间,按本地时间的整点对齐
+ * 间隔为天的整数倍时按一年中的第几天对齐,否则按当天的分钟数对齐,不能整除一天的间隔在零点重新开始
+ *
+ * @param t time.Time
+ * @param minutes int 周期,单位分钟
+ * @return time.Time
+ *
+ */
+func rotatePeriodStart(t time.Time, minutes int) time.Time {
+	y, m, d := t.Date()
+	if minutes % ROTATE_DAILY == 0 {
+		days := minutes / ROTATE_DAILY
+		return time.Date(y, m, d - (t.YearDay() - 1) % days, 0, 0, 0, 0, t.Location())
+	}
+	elapsed := t.Hour() * 60 + t.Minute()
+	return time.Date(y, m, d, 0, elapsed / minutes * minutes, 0, 0, t.Location())
+}
+
 //创建一个file句柄和Flogger
 func (this *Flog ) createFileHandleAndFlogger(filename, filePath string) error {
 	//再生成新的logger和fh
@@ -515,84 +1053,143 @@ func (this *Flog ) createFileHandleAndFlogger(filename, filePath string) error {
 	}
 	this.fhMap[filename] = fh
 	this.logerMap[filename] = log.New(fh, "", 0)
+	this.checkTimeMap[filename] = time.Now()
+	if info, err := fh.Stat(); err == nil {
+		this.infoMap[filename] = info
+	}else {
+		delete(this.infoMap, filename)
+	}
+	this.newBuffer(filename, fh)
+
+	//记录文件所属的周期,已存在的文件以最后修改时间为准
+	if this.LogRotateInterval > 0 {
+		t := time.Now()
+		if info, err := fh.Stat(); err == nil && info.Size() > 0 {
+			t = info.ModTime()
+		}
+		this.fileTimeMap[filename] = rotatePeriodStart(t, this.LogRotateInterval)
+	}
 	return nil
 }
 
-//归档
-func (this *Flog ) doArchive() {
+//归档成功之后记录日期,当天不再归档
+func (this *Flog ) doArchive(conf *fileConf, day string) {
+	defer atomic.StoreInt32(&this.archiving, 0)
+	if this.archive(conf) {
+		this.mu.Lock()
+		//归档期间修改了归档目录时当天还需要按新的配置归档
+		if this.fileConf().archiveDir() == conf.archiveDir() {
+			this.lastArchiveDay = day
+		}
+		this.mu.Unlock()
+		return
+	}
+	//没有拿到锁或者出错时过一分钟再重试
+	this.mu.Lock()
+	this.archiveRetryAt = time.Now().Add(time.Minute)
+	this.mu.Unlock()
+}
+
+//归档,返回是否完成
+func (this *Flog ) archive(conf *fileConf) bool {
 
 	//遍历日志目录
-	files, err := ioutil.ReadDir(this.LogPath)
+	files, err := ioutil.ReadDir(conf.logPath)
 	if err != nil {
-		log.Println(err)
-		return
+		this.handleError("archive", err)
+		return false
 	}
 
 	if len(files) == 0 {
-		return
+		return true
 	}
 
-	if len(this.ArchivePath) == 0 {
-		return
+	if len(conf.archivePath) == 0 {
+		return true
 	}
 
-	//如果今天已经归档过则不需要再归档
-	today := Date("Ymd")
-	if this.lastArchiveDay == today {
-		return
+	//多进程时只需要一个进程归档,其他进程正在归档时稍后重试
+	if conf.multiProcess {
+		unlock, err := lockFile(path.Join(conf.logPath, ".flog.archive.lock"), false)
+		if err != nil {
+			return false
+		}
+		defer unlock()
 	}
-	this.lastArchiveDay = today
-
-	var archiveDir string
+	atomic.AddInt64(&this.metrics.archives, 1)
 
-	if filepath.IsAbs(this.ArchivePath) {
-		archiveDir = this.ArchivePath
-	}else {
-		archiveDir = path.Join(this.LogPath, this.ArchivePath)
-	}
+	archiveDir := conf.archiveDir()
 
 	os.MkdirAll(archiveDir, os.ModePerm)
 
 	//获取今天凌晨的日期时间戳
 	td := Strtotime(Date("Ymd"), "Ymd")
 
+	ok := true
+	var archived []string
 	for _, f := range files {
-		//如果是目录,不用管他
-		if f.IsDir() {
+		//如果是目录或者隐藏文件(eg. 网络输出的暂存文件),不用管他
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		//正在压缩的文件和压缩的临时文件等压缩完成之后再归档
+		if _, ok := this.compressing.Load(path.Join(conf.logPath, f.Name())); ok || strings.HasSuffix(f.Name(), ".tmp") {
 			continue
 		}
 		//如果是文件,判断modtime是否为前一天的日期,并移动到archive目录里
 		if td > f.ModTime().Unix() {
 			newName := path.Join(archiveDir, f.Name())
-			//如果日志没有带日期,则归档时,自动带上日期
-			if this.DateFormat == "" {
-				newName = newName + "." + Date("Ymd", f.ModTime().Unix())
+			//如果日志没有带日期,则归档时,自动带上日期,压缩文件的扩展名保持在最后
+			if conf.dateFormat == "" {
+				cext := conf.compressExt()
+				if len(cext) > 0 && strings.HasSuffix(newName, cext) {
+					newName = strings.TrimSuffix(newName, cext) + "." + Date("Ymd", f.ModTime().Unix()) + cext
+				}else {
+					newName = newName + "." + Date("Ymd", f.ModTime().Unix())
+				}
 			}
 
-			os.Rename(path.Join(this.LogPath, f.Name()), newName)
+			if err := os.Rename(path.Join(conf.logPath, f.Name()), newName); err != nil {
+				this.handleError("archive", err)
+				ok = false
+				continue
+			}
+			archived = append(archived, newName)
 		}
 	}
 
+	//压缩归档的文件
+	for _, name := range archived {
+		this.compressFileAndReport(conf, name)
+	}
+
 	//清理日志文件
-	go this.delLogFiles(archiveDir)
+	go this.cleanup(conf)
+	return ok
+}
+
+//归档目录,不能持有锁
+func (this *Flog ) getArchiveDir() string {
+	return this.loadFileConf().archiveDir()
 }
 
-//删除日志文件
-func (this *Flog ) delLogFiles(archiveDir string) {
+//删除归档目录下超过保留天数的文件
+func (this *Flog ) delLogFiles(conf *fileConf) {
 	//keepDay设置为-1 则不删除文件
-	if this.LogKeepDay <= 0 {
+	if conf.logKeepDay <= 0 {
 		return
 	}
+	archiveDir := conf.archiveDir()
 
 	//遍历archive目录
 	files, err := ioutil.ReadDir(archiveDir)
 	if err != nil {
-		log.Println(err)
+		this.handleError("archive", err)
 		return
 	}
 
 	//保留的时间戳
-	keepSec := int64(this.LogKeepDay * 24 * 60 * 60)
+	keepSec := int64(conf.logKeepDay * 24 * 60 * 60)
 
 	//获取今天凌晨的日期时间戳
 	td := Strtotime(Date("Ymd"), "Ymd")
@@ -601,9 +1198,11 @@ func (this *Flog ) delLogFiles(archiveDir string) {
 			if f.IsDir() {
 				continue
 			}
-			//如果超过保留的天数,直接删除
+			//如果超过保留的天数,直接删除,压缩文件保留了原文件的修改时间,与未压缩的文件一样处理
 			if td - f.ModTime().Unix() > keepSec {
-				os.Remove(path.Join(archiveDir, f.Name()))
+				if err := os.Remove(path.Join(archiveDir, f.Name())); err != nil {
+					this.handleError("cleanup", err)
+				}
 			}
 		}
 	}
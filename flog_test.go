@@ -9,6 +9,11 @@ import (
 	"time"
 	"strings"
 	"os/exec"
+	"encoding/json"
+	"compress/gzip"
+	"io"
+	"errors"
+	"runtime"
 )
 
 /**
@@ -164,6 +169,97 @@ func TestLogModeCateLevel(t *testing.T) {
 	//os.RemoveAll(loger.LogPath)
 }
 
+//测试trace等级默认不输出,以及新等级的文件名
+func TestLevelTrace(t *testing.T) {
+	loger := New("/tmp/flog_trace")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogMode = LOGMODE_FILE_LEVEL
+	loger.Trace("t", "trace_message")
+	filename := path.Join(loger.LogPath, loger.FileName + ".trace")
+	if FileExist(filename) {
+		t.Fatal("Trace should be disabled by default")
+	}
+	loger.Level = LEVEL_TRACE
+	loger.Tracew("t", "trace_message", "k", 1)
+	b, _ := os.ReadFile(filename)
+	if !strings.Contains(string(b), "trace_message") {
+		t.Fatal("Trace was not written to", filename)
+	}
+}
+
+//测试Panic写完日志之后panic
+func TestPanic(t *testing.T) {
+	loger := New("/tmp/flog_panic")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetAsync(10)
+	defer func() {
+		r := recover()
+		if r != "panic_message" {
+			t.Fatal("Panic value is wrong.", r)
+		}
+		b, _ := os.ReadFile(path.Join(loger.LogPath, loger.FileName))
+		if !strings.Contains(string(b), "PANIC panic_message") {
+			t.Fatal("Panic message was not flushed.", string(b))
+		}
+		loger.Close()
+	}()
+	loger.Panic("p", "panic_message")
+}
+
+//测试Fatal写完日志并关闭之后退出
+func TestFatal(t *testing.T) {
+	loger := New("/tmp/flog_fatal")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetAsync(10)
+	code := -1
+	exitFunc = func(c int) {
+		code = c
+	}
+	defer func() {
+		exitFunc = os.Exit
+	}()
+	loger.Fatalw("f", "fatal_message", "uid", 1001)
+	if code != 1 {
+		t.Fatal("Fatal should exit with 1,", code)
+	}
+	b, _ := os.ReadFile(path.Join(loger.LogPath, loger.FileName))
+	if !strings.Contains(string(b), "FATAL fatal_message") {
+		t.Fatal("Fatal message was not flushed.", string(b))
+	}
+	loger.ErrorHandler = func(op string, err error) {}
+	loger.Info("i", "after fatal")
+	if !errors.Is(loger.Err(), ErrClosed) {
+		t.Fatal("Logger should be closed after Fatal")
+	}
+}
+
+//测试格式化日志
+func TestPrintf(t *testing.T) {
+	loger := New("/tmp/flog_printf")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetAsync(10)
+	loger.Level = LEVEL_INFO
+	loger.LogFlags = []int{LF_SHORTFILE, LF_LEVEL}
+	loger.Debugf("d", "%s", "debug_message")
+	_, _, line, _ := runtime.Caller(0)
+	loger.Infof("i", "%s=%d", "count", 3)
+	loger.Errorf("e", "%v|%q", []int{1, 2}, "x")
+	loger.Close()
+
+	b, err := os.ReadFile(path.Join(loger.LogPath, loger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	expected := []string{
+		"flog_test.go:" + strconv.Itoa(line + 1) + " INFO count=3",
+		"flog_test.go:" + strconv.Itoa(line + 2) + " ERROR [1 2]|\"x\"",
+	}
+	if len(lines) != len(expected) || lines[0] != expected[0] || lines[1] != expected[1] {
+		t.Fatal("Formatted messages are wrong.", lines)
+	}
+}
+
 //测试自定义日志输出的格式和顺序
 func TestLogFlags(t *testing.T) {
 	loger := New()
@@ -325,6 +421,204 @@ func TestArchive2(t *testing.T) {
 
 }
 
+//测试结构化字段
+func TestFields(t *testing.T) {
+	loger := New("/tmp/flog_fields")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogFlags = []int{LF_LEVEL, LF_CATE}
+	loger.Infow("req", "request done", "uid", 1001, "name", "a b", F("cost", "12ms"), "odd")
+	fh, err := os.Open(path.Join(loger.LogPath, loger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	line, _, err := bufio.NewReader(fh).ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `INFO req request done uid=1001 name="a b" cost=12ms odd=!MISSING`
+	if string(line) != expected {
+		t.Fatal("Fields do not show as expected.", string(line))
+	}
+}
+
+//测试json格式输出
+func TestLogFormatJSON(t *testing.T) {
+	loger := New("/tmp/flog_json")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogFormat = LOGFORMAT_JSON
+	loger.Warning("j", "line1\nline2\ttab")
+	loger.Infow("j", "done", "uid", 1001, "message", "dup")
+	fh, err := os.Open(path.Join(loger.LogPath, loger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	b := bufio.NewReader(fh)
+	var lines [][]byte
+	for {
+		line, _, err := b.ReadLine()
+		if err != nil {
+			break
+		}
+		lines = append(lines, append([]byte{}, line...))
+	}
+	if len(lines) != 2 {
+		t.Fatal(len(lines), "not 2 lines")
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(lines[0], &m); err != nil {
+		t.Fatal(err, string(lines[0]))
+	}
+	if m["level"] != "warning" || m["category"] != "j" || m["message"] != "line1\nline2\ttab" {
+		t.Fatal("Message does not show as expected.", string(lines[0]))
+	}
+	if !strings.Contains(m["caller"].(string), "flog_test.go") {
+		t.Fatal("Get call func name failed, ", string(lines[0]))
+	}
+	m = nil
+	if err := json.Unmarshal(lines[1], &m); err != nil {
+		t.Fatal(err, string(lines[1]))
+	}
+	if m["uid"] != float64(1001) || m["message"] != "done" || m["fields.message"] != "dup" {
+		t.Fatal("Fields do not show as expected.", string(lines[1]))
+	}
+}
+
+//测试按时间切割
+func TestRotateInterval(t *testing.T) {
+	loger := New("/tmp/flog_rotate_time")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogRotateInterval = ROTATE_HOURLY
+	filename := path.Join(loger.LogPath, loger.FileName)
+
+	//上两个小时写的日志
+	os.MkdirAll(loger.LogPath, os.ModePerm)
+	twoHourAgo := time.Now().Add(-2 * time.Hour)
+	if err := os.WriteFile(filename, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filename, twoHourAgo, twoHourAgo)
+
+	loger.Debug("d", "new")
+	loger.Debug("d", "new")
+
+	rotated := filename + "." + Date("YmdH", twoHourAgo.Unix())
+	b, err := os.ReadFile(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "old\n" {
+		t.Fatal("Rotated file does not contain old logs.", string(b))
+	}
+	b, err = os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "new") != 2 || strings.Contains(string(b), "old") {
+		t.Fatal("Live file does not contain new logs only.", string(b))
+	}
+}
+
+//测试同一分钟内多次按大小切割,文件不会被覆盖
+func TestRotateNoOverwrite(t *testing.T) {
+	loger := New("/tmp/flog_rotate_name")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogFlags = []int{LF_CATE}
+	loger.LogRotateSize = 1
+	line := strings.Repeat("x", 600)
+	for i := 0; i < 6; i++ {
+		loger.Debug("d", line)
+	}
+	files, _ := os.ReadDir(loger.LogPath)
+	total := 0
+	for _, f := range files {
+		b, _ := os.ReadFile(path.Join(loger.LogPath, f.Name()))
+		total += strings.Count(string(b), line)
+	}
+	if total != 6 {
+		t.Fatal("Lost logs after rotation,", total, "not 6")
+	}
+	if len(files) < 3 {
+		t.Fatal("Expected several rotated files,", len(files))
+	}
+}
+
+//测试按序号命名并保留扩展名
+func TestRotateSeqKeepExt(t *testing.T) {
+	loger := New("/tmp/flog_rotate_seq")
+	defer os.RemoveAll(loger.LogPath)
+	loger.FileName = "app.log"
+	loger.LogRotateSize = 1
+	loger.LogRotateNaming = ROTATENAME_SEQ
+	loger.LogRotateKeepExt = true
+	line := strings.Repeat("x", 1100)
+	for i := 0; i < 3; i++ {
+		loger.Debug("d", line)
+	}
+	for _, name := range []string{"app.log", "app.1.log", "app.2.log"} {
+		if !FileExist(path.Join(loger.LogPath, name)) {
+			t.Fatal("Rotated file does not exist,", name)
+		}
+	}
+}
+
+//测试切割之后压缩
+func TestRotateCompress(t *testing.T) {
+	loger := New("/tmp/flog_compress")
+	defer os.RemoveAll(loger.LogPath)
+	loger.FileName = "app.log"
+	loger.LogFlags = []int{LF_CATE}
+	loger.LogRotateSize = 1
+	loger.LogRotateNaming = ROTATENAME_SEQ
+	loger.LogCompress = &GzipCompressor{}
+	line := strings.Repeat("x", 1100)
+	loger.Debug("d", line)
+	loger.Debug("d", line)
+
+	gzName := path.Join(loger.LogPath, "app.log.1.gz")
+	for i := 0; i < 100 && !FileExist(gzName); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	fh, err := os.Open(gzName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	zr, err := gzip.NewReader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "d " + line + "\n" {
+		t.Fatal("Compressed file does not contain rotated logs.", len(b))
+	}
+	for i := 0; i < 100 && FileExist(path.Join(loger.LogPath, "app.log.1")); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if FileExist(path.Join(loger.LogPath, "app.log.1")) || FileExist(gzName + ".tmp") {
+		t.Fatal("Plain rotated file or temp file was left behind")
+	}
+}
+
+//测试周期的开始时间
+func TestRotatePeriodStart(t *testing.T) {
+	tm := time.Date(2026, 10, 18, 13, 47, 12, 0, time.Local)
+	cases := map[int]time.Time{
+		15:time.Date(2026, 10, 18, 13, 45, 0, 0, time.Local),
+		ROTATE_HOURLY:time.Date(2026, 10, 18, 13, 0, 0, 0, time.Local),
+		ROTATE_DAILY:time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local),
+	}
+	for minutes, expected := range cases {
+		if start := rotatePeriodStart(tm, minutes); !start.Equal(expected) {
+			t.Fatal(minutes, start, "not", expected)
+		}
+	}
+}
+
 //压力测试写入
 func BenchmarkFile(b *testing.B) {
 	loger := New()
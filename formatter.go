@@ -0,0 +1,144 @@
+package flog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 日志格式化接口
+ * 把一条日志格式化为要写出的字节,返回的内容应以换行结尾
+ */
+type Formatter interface {
+	Format(msg *LogMsg) ([]byte, error)
+}
+
+/**
+ * 文本格式,按Flags的顺序输出 LF_* 对应的内容,最后是消息和字段,以Separator分隔
+ * 这是Flog默认的格式
+ */
+type TextFormatter struct {
+	Flags     []int  //输出的格式以及顺序
+	Separator string //分隔符,默认为空格
+}
+
+//格式化消息 日期 文件位置 等级 类别 消息
+func (this *TextFormatter ) Format(msg *LogMsg) ([]byte, error) {
+	formatStr := make([]string, 0, len(this.Flags) + 1)
+	for _, flag := range this.Flags {
+		switch flag {
+		case LF_DATETIME:
+			formatStr = append(formatStr, msg.Time.Format("2006-01-02 15:04:05"))
+		case LF_LEVEL:
+			formatStr = append(formatStr, strings.ToUpper(LevelName(msg.Level)))
+		case LF_CATE:
+			formatStr = append(formatStr, msg.Category)
+		case LF_LONGFILE:
+			formatStr = append(formatStr, msg.File + ":" + strconv.Itoa(msg.Line))
+		case LF_SHORTFILE:
+			formatStr = append(formatStr, path.Base(msg.File) + ":" + strconv.Itoa(msg.Line))
+		}
+	}
+	message := msg.Message
+	if len(msg.Fields) > 0 {
+		message = strings.TrimSuffix(message, "\n") + formatFields(msg.Fields)
+	}
+	formatStr = append(formatStr, message)
+
+	separator := this.Separator
+	if len(separator) == 0 {
+		separator = " "
+	}
+	return []byte(strings.Join(formatStr, separator)), nil
+}
+
+/**
+ * json格式,每行一个json对象,包含 time level category caller message 以及所有字段
+ * 换行和控制字符都会被转义,字段名与内置的key冲突时加上 fields. 前缀
+ */
+type JSONFormatter struct {
+	ShortFile bool //caller只输出文件名,不输出绝对路径
+}
+
+func (this *JSONFormatter ) Format(msg *LogMsg) ([]byte, error) {
+	caller := msg.File
+	if this.ShortFile {
+		caller = path.Base(caller)
+	}
+	caller = caller + ":" + strconv.Itoa(msg.Line)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSONPair(&buf, "time", msg.Time.Format("2006-01-02T15:04:05.000Z07:00"), false)
+	writeJSONPair(&buf, "level", LevelName(msg.Level), true)
+	writeJSONPair(&buf, "category", msg.Category, true)
+	writeJSONPair(&buf, "caller", caller, true)
+	writeJSONPair(&buf, "message", strings.TrimSuffix(msg.Message, "\n"), true)
+	for _, f := range msg.Fields {
+		key := f.Key
+		switch key {
+		case "time", "level", "category", "caller", "message":
+			key = "fields." + key
+		}
+		writeJSONPair(&buf, key, f.Value, true)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+//写入一个json的 "key":value,无法序列化的值按 fmt.Sprint 的结果输出
+func writeJSONPair(buf *bytes.Buffer, key string, value interface{}, comma bool) {
+	if comma {
+		buf.WriteByte(',')
+	}
+	writeJSONValue(buf, key)
+	buf.WriteByte(':')
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	writeJSONValue(buf, value)
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		b.Reset()
+		enc.Encode(fmt.Sprint(value))
+	}
+	//Encode 会在末尾追加换行
+	buf.Write(bytes.TrimSuffix(b.Bytes(), []byte{'\n'}))
+}
+
+//把字段格式化为 key=value 的形式,值中包含空格,引号,等号或控制字符时加引号
+func formatFields(fields []Field) string {
+	var buf strings.Builder
+	for _, f := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		v := fmt.Sprint(f.Value)
+		if needQuote(v) {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
+	}
+	return buf.String()
+}
+
+func needQuote(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '"' || r == '=' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
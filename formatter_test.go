@@ -0,0 +1,49 @@
+package flog
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+//自定义的formatter,输出 pid|分类|消息
+type pidFormatter struct{}
+
+func (this *pidFormatter ) Format(msg *LogMsg) ([]byte, error) {
+	return []byte(strconv.Itoa(os.Getpid()) + "|" + msg.Category + "|" + msg.Message), nil
+}
+
+//测试自定义formatter
+func TestFormatter(t *testing.T) {
+	loger := New("/tmp/flog_formatter")
+	defer os.RemoveAll(loger.LogPath)
+	loger.Formatter = &pidFormatter{}
+	loger.Debug("f", "custom")
+	fh, err := os.Open(path.Join(loger.LogPath, loger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	line, _, err := bufio.NewReader(fh).ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strconv.Itoa(os.Getpid()) + "|f|custom"
+	if string(line) != expected {
+		t.Fatal("Message does not show as expected.", string(line))
+	}
+}
+
+//测试文本formatter
+func TestTextFormatter(t *testing.T) {
+	f := &TextFormatter{Flags:[]int{LF_LEVEL, LF_SHORTFILE, LF_CATE}, Separator:"|"}
+	b, err := f.Format(&LogMsg{Level:LEVEL_WARNING, Category:"c", Message:"m\n", File:"/a/b.go", Line:7, Fields:[]Field{F("k", "v")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "WARNING|b.go:7|c|m k=v" {
+		t.Fatal("Message does not show as expected.", string(b))
+	}
+}
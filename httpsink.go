@@ -0,0 +1,327 @@
+package flog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//http输出的请求体格式
+const (
+	HTTPFORMAT_JSON_ARRAY = iota        //一批日志组成一个json数组
+	HTTPFORMAT_NDJSON                    //每行一条日志
+)
+
+/**
+ * 批量POST日志到http接口
+ * 按条数,大小或者时间间隔攒成一批,由后台goroutine发送,5xx和网络错误按退避时间重试
+ * 待发送的数据超过MaxBufferSize时丢弃最早的一批
+ */
+type HTTPSink struct {
+	mu            sync.Mutex
+	URL           string            //接收日志的地址
+	Format        int               //HTTPFORMAT_JSON_ARRAY 或 HTTPFORMAT_NDJSON
+	Formatter     Formatter         //单条日志的格式,默认为JSONFormatter
+	Headers       map[string]string //额外的请求头
+	Gzip          bool              //是否gzip压缩请求体
+	BatchCount    int               //每批最多条数,默认100
+	BatchSize     int               //每批最大字节数,单位KB,默认1024
+	FlushInterval int               //最长多久发送一次,单位毫秒,默认1000
+	MaxRetries    int               //最多重试次数,默认3,-1表示不重试
+	RetryBackoff  int               //第一次重试的间隔,单位毫秒,之后翻倍,默认200
+	MaxBufferSize int               //内存中待发送数据的上限,单位KB,默认10240
+	Client        *http.Client      //默认超时10秒
+
+	batch         [][]byte   //当前正在攒的一批
+	batchBytes    int
+	queue         [][][]byte //等待发送的批次
+	queueBytes    int
+	sending       bool
+	idle          *sync.Cond
+	kick          chan struct{}
+	done          chan struct{}
+	exited        chan struct{}
+	started       bool
+	closed        bool
+	dropped       int64
+	flog          *Flog
+}
+
+/**
+ * 实例化一个http输出
+ *
+ * @param url string 接收日志的地址
+ * @return *HTTPSink
+ *
+ */
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{URL:url}
+}
+
+func (this *HTTPSink ) bindFlog(flog *Flog) {
+	this.flog = flog
+}
+
+func (this *HTTPSink ) Write(msg *LogMsg) error {
+	formatter := this.Formatter
+	if formatter == nil {
+		formatter = &JSONFormatter{}
+	}
+	b, err := formatter.Format(msg)
+	if err != nil {
+		return err
+	}
+	b = bytes.TrimRight(b, "\n")
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.closed {
+		atomic.AddInt64(&this.dropped, 1)
+		return errors.New("flog: http sink closed")
+	}
+	this.start()
+	this.batch = append(this.batch, b)
+	this.batchBytes += len(b) + 1
+	if len(this.batch) >= this.getBatchCount() || this.batchBytes >= this.getBatchSize() {
+		this.cut()
+	}
+	return nil
+}
+
+//发送所有待发送的日志,并等待发送完成
+func (this *HTTPSink ) Flush() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if !this.started {
+		return nil
+	}
+	this.cut()
+	for len(this.queue) > 0 || this.sending {
+		this.idle.Wait()
+	}
+	return nil
+}
+
+func (this *HTTPSink ) Close() error {
+	this.Flush()
+	this.mu.Lock()
+	if this.closed || !this.started {
+		this.closed = true
+		this.mu.Unlock()
+		return nil
+	}
+	this.closed = true
+	this.mu.Unlock()
+	close(this.done)
+	<-this.exited
+	return nil
+}
+
+//被丢弃的日志条数
+func (this *HTTPSink ) Dropped() int64 {
+	return atomic.LoadInt64(&this.dropped)
+}
+
+func (this *HTTPSink ) getBatchCount() int {
+	if this.BatchCount <= 0 {
+		return 100
+	}
+	return this.BatchCount
+}
+
+func (this *HTTPSink ) getBatchSize() int {
+	if this.BatchSize <= 0 {
+		return 1024 << 10
+	}
+	return this.BatchSize << 10
+}
+
+//启动后台发送的goroutine,需要持有锁
+func (this *HTTPSink ) start() {
+	if this.started {
+		return
+	}
+	this.started = true
+	this.idle = sync.NewCond(&this.mu)
+	this.kick = make(chan struct{}, 1)
+	this.done = make(chan struct{})
+	this.exited = make(chan struct{})
+	go this.run()
+}
+
+//把当前的一批放入发送队列,超过内存上限时丢弃最早的批次,需要持有锁
+func (this *HTTPSink ) cut() {
+	if len(this.batch) == 0 {
+		return
+	}
+	this.queue = append(this.queue, this.batch)
+	this.queueBytes += this.batchBytes
+	this.batch = nil
+	this.batchBytes = 0
+
+	maxBytes := this.MaxBufferSize << 10
+	if maxBytes <= 0 {
+		maxBytes = 10240 << 10
+	}
+	for this.queueBytes > maxBytes && len(this.queue) > 1 {
+		this.queueBytes -= batchBytes(this.queue[0])
+		atomic.AddInt64(&this.dropped, int64(len(this.queue[0])))
+		this.queue = this.queue[1:]
+	}
+	select {
+	case this.kick <- struct{}{}:
+	default:
+	}
+}
+
+func batchBytes(batch [][]byte) int {
+	n := 0
+	for _, b := range batch {
+		n += len(b) + 1
+	}
+	return n
+}
+
+//后台发送
+func (this *HTTPSink ) run() {
+	defer close(this.exited)
+	interval := time.Duration(this.FlushInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.kick:
+		case <-ticker.C:
+			this.mu.Lock()
+			this.cut()
+			this.mu.Unlock()
+		case <-this.done:
+			this.sendQueued()
+			return
+		}
+		this.sendQueued()
+	}
+}
+
+//依次发送队列中的批次
+func (this *HTTPSink ) sendQueued() {
+	for {
+		this.mu.Lock()
+		if len(this.queue) == 0 {
+			this.sending = false
+			this.idle.Broadcast()
+			this.mu.Unlock()
+			return
+		}
+		batch := this.queue[0]
+		this.queue = this.queue[1:]
+		this.queueBytes -= batchBytes(batch)
+		this.sending = true
+		this.mu.Unlock()
+
+		if err := this.send(batch); err != nil {
+			atomic.AddInt64(&this.dropped, int64(len(batch)))
+			err = fmt.Errorf("fail to post logs to %s: %w", this.URL, err)
+			if this.flog != nil {
+				this.flog.handleError("sink.http", err)
+			}else {
+				log.Println("flog:", err)
+			}
+		}
+	}
+}
+
+//发送一批日志,5xx和网络错误时重试
+func (this *HTTPSink ) send(batch [][]byte) error {
+	var body bytes.Buffer
+	var w io.Writer = &body
+	var zw *gzip.Writer
+	if this.Gzip {
+		zw = gzip.NewWriter(&body)
+		w = zw
+	}
+	contentType := "application/json"
+	if this.Format == HTTPFORMAT_NDJSON {
+		contentType = "application/x-ndjson"
+		for _, b := range batch {
+			w.Write(b)
+			w.Write([]byte{'\n'})
+		}
+	}else {
+		w.Write([]byte{'['})
+		for i, b := range batch {
+			if i > 0 {
+				w.Write([]byte{','})
+			}
+			w.Write(b)
+		}
+		w.Write([]byte{']'})
+	}
+	if zw != nil {
+		zw.Close()
+	}
+
+	client := this.Client
+	if client == nil {
+		client = &http.Client{Timeout:10 * time.Second}
+	}
+	retries := this.MaxRetries
+	if retries == 0 {
+		retries = 3
+	}
+	backoff := time.Duration(this.RetryBackoff) * time.Millisecond
+	if backoff <= 0 {
+		backoff = 200 * time.Millisecond
+	}
+
+	var err error
+	for i := 0; ; i++ {
+		var retry bool
+		retry, err = this.post(client, body.Bytes(), contentType)
+		if err == nil || !retry || i >= retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+//发送一次请求,返回是否需要重试
+func (this *HTTPSink ) post(client *http.Client, body []byte, contentType string) (bool, error) {
+	req, err := http.NewRequest("POST", this.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if this.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range this.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return true, errors.New("flog: http status " + strconv.Itoa(resp.StatusCode))
+	}
+	if resp.StatusCode >= 300 {
+		return false, errors.New("flog: http status " + strconv.Itoa(resp.StatusCode))
+	}
+	return false, nil
+}
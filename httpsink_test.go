@@ -0,0 +1,69 @@
+package flog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+//测试http批量输出,gzip以及5xx重试
+func TestHTTPSink(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]map[string]interface{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		//第一次请求返回500,需要重试
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Error("Request body is not gzipped")
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var batch []map[string]interface{}
+		if err := json.NewDecoder(zr).Decode(&batch); err != nil {
+			t.Error(err)
+			return
+		}
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	loger := New("/tmp/flog_http")
+	defer os.RemoveAll(loger.LogPath)
+	loger.DisableFileLog = true
+	sink := NewHTTPSink(server.URL)
+	sink.Gzip = true
+	sink.BatchCount = 2
+	sink.RetryBackoff = 10
+	loger.AddSink(sink)
+	loger.SetAsync(10)
+	loger.Infow("h", "m1", "n", 1)
+	loger.Infow("h", "m2", "n", 2)
+	loger.Infow("h", "m3", "n", 3)
+	loger.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatal("Batches do not work as expected.", batches)
+	}
+	if batches[0][0]["message"] != "m1" || batches[1][0]["n"] != float64(3) {
+		t.Fatal("Entries do not show as expected.", batches)
+	}
+	if sink.Dropped() != 0 {
+		t.Fatal("No message should be dropped", sink.Dropped())
+	}
+}
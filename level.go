@@ -0,0 +1,122 @@
+package flog
+
+import (
+	"errors"
+	"strings"
+)
+
+/**
+ * 运行时修改全局的日志等级,可以和写日志同时调用
+ * 调用之后再直接修改Level字段不会生效
+ *
+ * @param level int
+ * @return *Flog
+ *
+ */
+func (this *Flog ) SetLevel(level int) *Flog {
+	this.level.Store(level)
+	return this
+}
+
+//获取全局的日志等级
+func (this *Flog ) GetLevel() int {
+	if level, ok := this.level.Load().(int); ok {
+		return level
+	}
+	return this.Level
+}
+
+/**
+ * 根据等级的label获取等级,不区分大小写 eg. debug WARNING
+ *
+ * @param name string
+ * @return int, error
+ *
+ */
+func ParseLevel(name string) (int, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for level, label := range levels {
+		if label == name {
+			return level, nil
+		}
+	}
+	return 0, errors.New("flog: unknown level " + name)
+}
+
+/**
+ * 设置分类的日志等级,覆盖全局的Level
+ * 分类以.分层,没有设置等级的分类使用上一层的等级,eg. db.query 依次使用 db.query db 的等级,都没有设置时使用Level
+ *
+ * @param category string
+ * @param level int
+ * @return *Flog
+ *
+ */
+func (this *Flog ) SetCategoryLevel(category string, level int) *Flog {
+	this.confMu.Lock()
+	defer this.confMu.Unlock()
+	levels := this.copyCategoryLevels()
+	levels[category] = level
+	this.categoryLevels.Store(levels)
+	return this
+}
+
+//删除分类的日志等级,之后使用上一层的等级
+func (this *Flog ) RemoveCategoryLevel(category string) *Flog {
+	this.confMu.Lock()
+	defer this.confMu.Unlock()
+	levels := this.copyCategoryLevels()
+	delete(levels, category)
+	this.categoryLevels.Store(levels)
+	return this
+}
+
+//获取所有设置过的分类等级
+func (this *Flog ) CategoryLevels() map[string]int {
+	this.confMu.Lock()
+	defer this.confMu.Unlock()
+	return this.copyCategoryLevels()
+}
+
+//获取分类实际使用的日志等级
+func (this *Flog ) CategoryLevel(category string) int {
+	if levels, _ := this.categoryLevels.Load().(map[string]int); len(levels) > 0 {
+		for {
+			if level, ok := levels[category]; ok {
+				return level
+			}
+			i := strings.LastIndexByte(category, '.')
+			if i < 0 {
+				break
+			}
+			category = category[:i]
+		}
+	}
+	return this.GetLevel()
+}
+
+//分类的level等级日志是否需要输出,在格式化之前调用
+func (this *Flog ) enabled(category string, level int) bool {
+	return level >= this.CategoryLevel(category)
+}
+
+//替换所有的分类等级
+func (this *Flog ) setCategoryLevels(levels map[string]int) {
+	this.confMu.Lock()
+	defer this.confMu.Unlock()
+	copied := make(map[string]int, len(levels))
+	for k, v := range levels {
+		copied[k] = v
+	}
+	this.categoryLevels.Store(copied)
+}
+
+//复制分类等级,写时复制保证读的时候不需要加锁,需要持有confMu
+func (this *Flog ) copyCategoryLevels() map[string]int {
+	old, _ := this.categoryLevels.Load().(map[string]int)
+	levels := make(map[string]int, len(old) + 1)
+	for k, v := range old {
+		levels[k] = v
+	}
+	return levels
+}
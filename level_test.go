@@ -0,0 +1,62 @@
+package flog
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+//测试分类等级的继承
+func TestCategoryLevel(t *testing.T) {
+	loger := New("/tmp/flog_cate_level")
+	defer os.RemoveAll(loger.LogPath)
+	loger.Level = LEVEL_WARNING
+	loger.SetCategoryLevel("db", LEVEL_DEBUG).SetCategoryLevel("db.query.slow", LEVEL_ERROR)
+
+	cases := map[string]int{
+		"http":          LEVEL_WARNING,
+		"db":            LEVEL_DEBUG,
+		"db.query":      LEVEL_DEBUG,
+		"db.query.slow": LEVEL_ERROR,
+		"dbx":           LEVEL_WARNING,
+	}
+	for category, level := range cases {
+		if l := loger.CategoryLevel(category); l != level {
+			t.Fatal("Level of", category, "is", l, "not", level)
+		}
+	}
+
+	loger.Debug("db.query", "db_debug")
+	loger.Debug("http", "http_debug")
+	loger.Warning("db.query.slow", "slow_warning")
+	loger.Warning("http", "http_warning")
+	b, _ := os.ReadFile(path.Join(loger.LogPath, loger.FileName))
+	content := string(b)
+	if !strings.Contains(content, "db_debug") || !strings.Contains(content, "http_warning") {
+		t.Fatal("Enabled messages were not written.", content)
+	}
+	if strings.Contains(content, "http_debug") || strings.Contains(content, "slow_warning") {
+		t.Fatal("Disabled messages were written.", content)
+	}
+
+	loger.RemoveCategoryLevel("db")
+	if loger.CategoryLevel("db.query") != LEVEL_WARNING || len(loger.CategoryLevels()) != 1 {
+		t.Fatal("Removed level should fall back to the global level.", loger.CategoryLevels())
+	}
+}
+
+//测试调用SetLevel之前直接修改Level字段生效,之后使用SetLevel的等级
+func TestLevelField(t *testing.T) {
+	loger := New("/tmp/flog_level_field")
+	defer os.RemoveAll(loger.LogPath)
+	loger.Debug("d", "debug_message")
+	loger.Level = LEVEL_ERROR
+	if loger.GetLevel() != LEVEL_ERROR || loger.enabled("d", LEVEL_INFO) {
+		t.Fatal("Level field should be used before SetLevel.", loger.GetLevel())
+	}
+	loger.SetLevel(LEVEL_WARNING)
+	if loger.GetLevel() != LEVEL_WARNING || !loger.enabled("d", LEVEL_WARNING) {
+		t.Fatal("SetLevel should change the level.", loger.GetLevel())
+	}
+}
@@ -0,0 +1,190 @@
+package flog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//http接口中的日志等级,等级使用label表示 eg. debug
+type levelState struct {
+	Level      string            `json:"level"`
+	Categories map[string]string `json:"categories"`
+	TTL        string            `json:"ttl,omitempty"`       //修改之后多久恢复,eg. 10m,只在PUT时使用
+	RevertAt   string            `json:"revert_at,omitempty"` //恢复的时间,只在返回时使用
+}
+
+//运行时修改日志等级的http接口
+type levelHandler struct {
+	flog     *Flog
+	mu       sync.Mutex
+	gen      int            //每次修改加1,过期的恢复不再执行
+	saved    *levelSnapshot //设置了ttl时修改之前的等级
+	revertAt time.Time
+	timer    *time.Timer
+}
+
+//带ttl修改之前的等级,只记录修改过的,恢复时不影响期间其他地方的修改(eg. 重新加载配置)
+type levelSnapshot struct {
+	level      *int            //修改之前的全局等级,没有修改时为nil
+	categories map[string]*int //修改过的分类之前的等级,之前没有设置时为nil
+}
+
+/**
+ * 查看和修改日志等级的http接口,eg. http.Handle("/flog/level", loger.LevelHandler())
+ * GET 返回 {"level":"info","categories":{"db":"debug"}}
+ * PUT 修改body中出现的等级,分类的等级为空时删除该分类的等级
+ * 设置ttl时到期后把修改过的等级恢复为第一次带ttl修改之前的值,eg. {"categories":{"db":"debug"},"ttl":"10m"}
+ *
+ * @return http.Handler
+ *
+ */
+func (this *Flog ) LevelHandler() http.Handler {
+	return &levelHandler{flog:this}
+}
+
+func (this *levelHandler ) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		this.mu.Lock()
+		state := this.state()
+		this.mu.Unlock()
+		writeLevelState(w, state)
+	case http.MethodPut:
+		var req levelState
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		state, err := this.update(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeLevelState(w, state)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+//校验并修改等级,全部合法时才修改
+func (this *levelHandler ) update(req *levelState) (*levelState, error) {
+	var level int
+	if len(req.Level) > 0 {
+		l, err := ParseLevel(req.Level)
+		if err != nil {
+			return nil, err
+		}
+		level = l
+	}
+	categories := make(map[string]int, len(req.Categories))
+	for category, name := range req.Categories {
+		if len(name) == 0 {
+			continue
+		}
+		l, err := ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		categories[category] = l
+	}
+	var ttl time.Duration
+	if len(req.TTL) > 0 {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return nil, err
+		}
+		ttl = d
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.gen++
+	if this.timer != nil {
+		this.timer.Stop()
+		this.timer = nil
+	}
+	if ttl > 0 {
+		//连续带ttl修改时恢复为第一次修改之前的等级
+		if this.saved == nil {
+			this.saved = &levelSnapshot{categories:make(map[string]*int)}
+		}
+		if len(req.Level) > 0 && this.saved.level == nil {
+			l := this.flog.GetLevel()
+			this.saved.level = &l
+		}
+		old := this.flog.CategoryLevels()
+		for category := range req.Categories {
+			if _, ok := this.saved.categories[category]; ok {
+				continue
+			}
+			if l, ok := old[category]; ok {
+				this.saved.categories[category] = &l
+			}else {
+				this.saved.categories[category] = nil
+			}
+		}
+		gen := this.gen
+		this.revertAt = time.Now().Add(ttl)
+		this.timer = time.AfterFunc(ttl, func() {
+			this.revert(gen)
+		})
+	}else {
+		this.saved = nil
+	}
+
+	if len(req.Level) > 0 {
+		this.flog.SetLevel(level)
+	}
+	for category, name := range req.Categories {
+		if l, ok := categories[category]; ok && len(name) > 0 {
+			this.flog.SetCategoryLevel(category, l)
+		}else {
+			this.flog.RemoveCategoryLevel(category)
+		}
+	}
+	return this.state(), nil
+}
+
+//ttl到期之后恢复修改过的等级
+func (this *levelHandler ) revert(gen int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if gen != this.gen || this.saved == nil {
+		return
+	}
+	if this.saved.level != nil {
+		this.flog.SetLevel(*this.saved.level)
+	}
+	for category, level := range this.saved.categories {
+		if level != nil {
+			this.flog.SetCategoryLevel(category, *level)
+		}else {
+			this.flog.RemoveCategoryLevel(category)
+		}
+	}
+	this.saved = nil
+	this.timer = nil
+}
+
+//当前的等级,需要持有mu
+func (this *levelHandler ) state() *levelState {
+	state := &levelState{
+		Level:LevelName(this.flog.GetLevel()),
+		Categories:make(map[string]string),
+	}
+	for category, level := range this.flog.CategoryLevels() {
+		state.Categories[category] = LevelName(level)
+	}
+	if this.saved != nil {
+		state.RevertAt = this.revertAt.Format(time.RFC3339)
+	}
+	return state
+}
+
+func writeLevelState(w http.ResponseWriter, state *levelState) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
@@ -0,0 +1,122 @@
+package flog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//发送请求并解析返回的等级
+func doLevelRequest(t *testing.T, handler http.Handler, method, body string) (int, levelState) {
+	req := httptest.NewRequest(method, "/flog/level", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var state levelState
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, state
+}
+
+//测试通过http查看和修改等级
+func TestLevelHandler(t *testing.T) {
+	loger := New("/tmp/flog_level_handler")
+	defer os.RemoveAll(loger.LogPath)
+	loger.Level = LEVEL_INFO
+	loger.SetCategoryLevel("db", LEVEL_ERROR)
+	handler := loger.LevelHandler()
+
+	code, state := doLevelRequest(t, handler, http.MethodGet, "")
+	if code != http.StatusOK || state.Level != "info" || state.Categories["db"] != "error" {
+		t.Fatal("GET returns wrong levels.", code, state)
+	}
+
+	code, state = doLevelRequest(t, handler, http.MethodPut, `{"level":"WARNING","categories":{"db":"","http":"debug"}}`)
+	if code != http.StatusOK || state.Level != "warning" || state.Categories["http"] != "debug" || len(state.Categories) != 1 {
+		t.Fatal("PUT returns wrong levels.", code, state)
+	}
+	if loger.GetLevel() != LEVEL_WARNING || loger.CategoryLevel("db") != LEVEL_WARNING || loger.CategoryLevel("http.client") != LEVEL_DEBUG {
+		t.Fatal("PUT did not change the levels")
+	}
+
+	//非法的等级不修改任何等级
+	if code, _ := doLevelRequest(t, handler, http.MethodPut, `{"level":"error","categories":{"db":"loud"}}`); code != http.StatusBadRequest {
+		t.Fatal("Invalid level should be rejected,", code)
+	}
+	if loger.GetLevel() != LEVEL_WARNING {
+		t.Fatal("Invalid request should not change the levels")
+	}
+	if code, _ := doLevelRequest(t, handler, http.MethodPost, `{}`); code != http.StatusMethodNotAllowed {
+		t.Fatal("POST should not be allowed,", code)
+	}
+}
+
+//测试ttl到期之后恢复
+func TestLevelHandlerTTL(t *testing.T) {
+	loger := New("/tmp/flog_level_ttl")
+	defer os.RemoveAll(loger.LogPath)
+	loger.Level = LEVEL_WARNING
+	handler := loger.LevelHandler()
+
+	_, state := doLevelRequest(t, handler, http.MethodPut, `{"level":"debug","ttl":"100ms"}`)
+	if state.RevertAt == "" || loger.GetLevel() != LEVEL_DEBUG {
+		t.Fatal("PUT with ttl should change the level and report revert_at.", state)
+	}
+	//再次带ttl修改时恢复为第一次修改之前的等级
+	doLevelRequest(t, handler, http.MethodPut, `{"categories":{"db":"trace"},"ttl":"150ms"}`)
+	time.Sleep(50 * time.Millisecond)
+	if loger.GetLevel() != LEVEL_DEBUG || loger.CategoryLevel("db") != LEVEL_TRACE {
+		t.Fatal("Levels should not be reverted before the ttl")
+	}
+	time.Sleep(250 * time.Millisecond)
+	if loger.GetLevel() != LEVEL_WARNING || len(loger.CategoryLevels()) != 0 {
+		t.Fatal("Levels should be reverted after the ttl.", loger.GetLevel(), loger.CategoryLevels())
+	}
+}
+
+//测试ttl到期之后只恢复修改过的等级,期间其他的修改保留
+func TestLevelHandlerTTLKeepsOtherChanges(t *testing.T) {
+	loger := New("/tmp/flog_level_ttl_keep")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetLevel(LEVEL_WARNING).SetCategoryLevel("db", LEVEL_ERROR)
+	handler := loger.LevelHandler()
+
+	doLevelRequest(t, handler, http.MethodPut, `{"categories":{"db":"debug","http":"trace"},"ttl":"100ms"}`)
+	//ttl期间重新加载了配置
+	loger.SetLevel(LEVEL_INFO).SetCategoryLevel("cache", LEVEL_ERROR)
+	time.Sleep(250 * time.Millisecond)
+	levels := loger.CategoryLevels()
+	if loger.GetLevel() != LEVEL_INFO || levels["db"] != LEVEL_ERROR || levels["cache"] != LEVEL_ERROR || len(levels) != 2 {
+		t.Fatal("Only levels changed by PUT should be reverted.", loger.GetLevel(), levels)
+	}
+}
+
+//测试修改等级和写日志同时进行
+func TestSetLevelConcurrent(t *testing.T) {
+	loger := New("/tmp/flog_level_race")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetAsync(1000)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			loger.SetLevel(i % 2).SetCategoryLevel("db", i % 3)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			loger.Debug("db", "debug_message")
+		}
+	}()
+	wg.Wait()
+	loger.Close()
+}
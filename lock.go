@@ -0,0 +1,46 @@
+package flog
+
+import (
+	"os"
+	"path"
+)
+
+//日志对应的锁文件,按不带日期的日志名加锁,每个日志只有一个锁文件,隐藏文件不会被归档和清理
+func (this *Flog ) lockPath(filename string) string {
+	return path.Join(this.LogPath, "." + this.baseName(filename) + ".lock")
+}
+
+//去掉文件名中DateFormat的日期,日期的长度是固定的
+func (this *Flog ) baseName(filename string) string {
+	if len(this.DateFormat) == 0 {
+		return filename
+	}
+	n := len(Date(this.DateFormat)) + 1
+	if len(filename) > n {
+		return filename[:len(filename) - n]
+	}
+	return filename
+}
+
+/**
+ * 打开的文件与路径是否还是同一个文件,文件被删除或者被重命名时返回false
+ * 使用打开时记录的文件信息,每次只需要stat路径,路径的信息会记录下来供切割判断大小
+ */
+func (this *Flog ) sameFile(filename string, fh *os.File, filePath string) bool {
+	info, ok := this.infoMap[filename]
+	if !ok {
+		var err error
+		if info, err = fh.Stat(); err != nil {
+			return false
+		}
+	}
+	pathInfo, err := os.Stat(filePath)
+	if err != nil {
+		return false
+	}
+	if !os.SameFile(info, pathInfo) {
+		return false
+	}
+	this.infoMap[filename] = pathInfo
+	return true
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package flog
+
+//不支持flock的系统不加锁
+func lockFile(lockPath string, block bool) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,72 @@
+package flog
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+//测试多个进程写同一个文件时的切割,这里用两个Flog模拟两个进程
+func TestMultiProcessRotate(t *testing.T) {
+	a := New("/tmp/flog_multi")
+	defer os.RemoveAll(a.LogPath)
+	b := New("/tmp/flog_multi")
+	for _, loger := range []*Flog{a, b} {
+		loger.MultiProcess = true
+		loger.LogRotateSize = 1
+		loger.LogRotateNaming = ROTATENAME_SEQ
+		loger.LogFlags = []int{LF_CATE}
+	}
+
+	a.Debug("a", strings.Repeat("x", 1100))
+	//b 打开文件时发现超过大小,切割之后写入新文件
+	b.Debug("b", "b1")
+	//a 的句柄还指向切割之后的文件,需要重新打开当前文件
+	a.Debug("a", "a2")
+
+	live, err := os.ReadFile(path.Join(a.LogPath, a.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(live) != "b b1\na a2\n" {
+		t.Fatal("Live file does not show as expected.", string(live))
+	}
+	rotated, err := os.ReadFile(path.Join(a.LogPath, a.FileName + ".1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(rotated), "a2") || strings.Contains(string(rotated), "b1") {
+		t.Fatal("Rotated file should only contain old logs")
+	}
+	if FileExist(path.Join(a.LogPath, a.FileName + ".2")) {
+		t.Fatal("File should be rotated only once")
+	}
+}
+
+//测试按日期命名时每个日志只有一个锁文件
+func TestMultiProcessLockFile(t *testing.T) {
+	loger := New("/tmp/flog_multi_lock")
+	os.RemoveAll(loger.LogPath)
+	defer os.RemoveAll(loger.LogPath)
+	loger.MultiProcess = true
+	loger.LogRotateSize = 1
+	loger.LogRotateNaming = ROTATENAME_SEQ
+	loger.DateFormat = "Ymd"
+	for i := 0; i < 3; i++ {
+		loger.Debug("a", strings.Repeat("x", 1100))
+	}
+	files, _ := os.ReadDir(loger.LogPath)
+	var locks []string
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".lock") {
+			locks = append(locks, f.Name())
+		}
+	}
+	if len(locks) != 1 || locks[0] != "." + loger.FileName + ".lock" {
+		t.Fatal("Lock files do not show as expected.", locks)
+	}
+	if !FileExist(path.Join(loger.LogPath, loger.FileName + "." + Date("Ymd") + ".1")) {
+		t.Fatal("File should be rotated")
+	}
+}
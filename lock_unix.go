@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package flog
+
+import (
+	"os"
+	"syscall"
+)
+
+/**
+ * 对锁文件加flock排它锁,进程退出时锁会自动释放
+ *
+ * @param lockPath string 锁文件
+ * @param block bool 是否等待,不等待时拿不到锁返回错误
+ * @return func(), error 解锁函数
+ *
+ */
+func lockFile(lockPath string, block bool) (func(), error) {
+	fh, err := os.OpenFile(lockPath, os.O_RDWR | os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_EX
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err = syscall.Flock(int(fh.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(fh.Fd()), syscall.LOCK_UN)
+		fh.Close()
+	}, nil
+}
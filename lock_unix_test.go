@@ -0,0 +1,58 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package flog
+
+import (
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//等待后台归档完成
+func waitArchive(loger *Flog) {
+	for i := 0; i < 100 && atomic.LoadInt32(&loger.archiving) == 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+//测试其他进程正在归档时没有拿到锁,之后会重试
+func TestArchiveRetry(t *testing.T) {
+	loger := New("/tmp/flog_archive_retry")
+	os.RemoveAll(loger.LogPath)
+	defer os.RemoveAll(loger.LogPath)
+	loger.MultiProcess = true
+	loger.NeedArchive = true
+	oldPath := path.Join(loger.LogPath, "old.log")
+	twoDayAgo := time.Now().Add(-48 * time.Hour)
+	touchLogFile(t, oldPath, 10, twoDayAgo)
+
+	//模拟其他进程正在归档
+	unlock, err := lockFile(path.Join(loger.LogPath, ".flog.archive.lock"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loger.Debug("d", "debug_message")
+	waitArchive(loger)
+	loger.mu.Lock()
+	day := loger.lastArchiveDay
+	loger.mu.Unlock()
+	if !FileExist(oldPath) || day != "" {
+		t.Fatal("Archive should not be done without the lock.", day)
+	}
+
+	unlock()
+	loger.mu.Lock()
+	loger.archiveRetryAt = time.Time{}
+	loger.mu.Unlock()
+	loger.Debug("d", "debug_message")
+	waitArchive(loger)
+	archived := path.Join(loger.getArchiveDir(), "old.log." + Date("Ymd", twoDayAgo.Unix()))
+	loger.mu.Lock()
+	day = loger.lastArchiveDay
+	loger.mu.Unlock()
+	if !FileExist(archived) || day != Date("Ymd") {
+		t.Fatal("Archive should be retried.", day)
+	}
+}
@@ -0,0 +1,350 @@
+package flog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//暂存文件超过MaxSpoolSize
+var ErrSpoolFull = errors.New("flog: network spool file is full")
+
+//补发时每次发送的大小
+const replayChunkSize = 64 << 10
+
+/**
+ * 可靠的网络输出,按行发送到tcp或unix socket
+ * 连接断开时把消息暂存到LogPath下的文件,并按退避时间重连,连上之后先按顺序补发暂存的消息
+ * 异步模式下写入和重连都在collect的goroutine中执行,不会阻塞写日志的调用方
+ */
+type NetworkSink struct {
+	mu           sync.Mutex
+	Network      string    //tcp unix
+	Addr         string    //地址
+	Formatter    Formatter //格式,默认与Flog的文件日志一致
+	SpoolFile    string    //暂存文件,相对路径时位于第一次使用时的LogPath下,默认为 .flog_<network>_<addr>.spool
+	MinBackoff   int       //重连的最小间隔,单位毫秒,默认100
+	MaxBackoff   int       //重连的最大间隔,单位毫秒,默认30000
+	DialTimeout  int       //连接超时,单位毫秒,默认3000
+	WriteTimeout int       //写超时,单位毫秒,默认5000
+	MaxSpoolSize int       //暂存文件的大小上限,单位KB,默认102400(100M),超过时丢弃新的消息,-1表示不限制
+	flog         *Flog
+	conn         net.Conn
+	backoff      time.Duration //当前的重连间隔
+	nextDial     time.Time     //下次允许重连的时间
+	spooled      bool          //暂存文件中是否有未发送的消息
+	spoolSize    int64         //暂存文件的大小
+	spoolFull    bool          //暂存文件是否已满,已满时只报告一次错误
+	dropped      int64         //暂存文件已满时丢弃的消息数
+	checked      bool          //是否检查过上次进程遗留的暂存文件
+	spoolFile    string        //第一次使用时确定的暂存文件路径
+}
+
+/**
+ * 实例化一个网络输出
+ *
+ * @param network string tcp unix
+ * @param addr string 地址
+ * @return *NetworkSink
+ *
+ */
+func NewNetworkSink(network, addr string) *NetworkSink {
+	return &NetworkSink{Network:network, Addr:addr}
+}
+
+func (this *NetworkSink ) bindFlog(flog *Flog) {
+	this.flog = flog
+}
+
+func (this *NetworkSink ) Write(msg *LogMsg) error {
+	b := []byte(msg.formatMsg)
+	if this.Formatter != nil {
+		var err error
+		if b, err = this.Formatter.Format(msg); err != nil {
+			return err
+		}
+	}
+	if len(b) == 0 || b[len(b) - 1] != '\n' {
+		b = append(b, '\n')
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.checkSpool()
+	this.reconnect()
+	if this.conn != nil && !this.spooled {
+		if err := this.send(b); err == nil {
+			return nil
+		}
+	}
+	return this.spool(b)
+}
+
+//尝试重连并补发暂存的消息
+func (this *NetworkSink ) Flush() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.checkSpool()
+	this.reconnect()
+	return nil
+}
+
+//关闭之前不考虑退避时间再尝试一次连接和补发
+func (this *NetworkSink ) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.checkSpool()
+	if this.spooled {
+		this.nextDial = time.Time{}
+		this.reconnect()
+	}
+	if this.conn == nil {
+		return nil
+	}
+	err := this.conn.Close()
+	this.conn = nil
+	return err
+}
+
+/**
+ * 暂存文件的路径,第一次使用时确定,之后重新加载配置修改LogPath不会移动暂存文件
+ * 在collect的goroutine中调用,没有持有Flog的锁,通过配置快照读取LogPath
+ */
+func (this *NetworkSink ) spoolPath() string {
+	if len(this.spoolFile) > 0 {
+		return this.spoolFile
+	}
+	name := this.SpoolFile
+	if len(name) == 0 {
+		name = ".flog_" + strings.NewReplacer("/", "_", ":", "_", "\\", "_").Replace(this.Network + "_" + this.Addr) + ".spool"
+	}
+	if !filepath.IsAbs(name) {
+		logPath := "logs"
+		if this.flog != nil {
+			if conf := this.flog.loadFileConf(); len(conf.logPath) > 0 {
+				logPath = conf.logPath
+			}
+		}
+		name = path.Join(logPath, name)
+	}
+	this.spoolFile = name
+	return name
+}
+
+//检查上次进程遗留的暂存文件
+func (this *NetworkSink ) checkSpool() {
+	if this.checked {
+		return
+	}
+	this.checked = true
+	if info, err := os.Stat(this.spoolPath()); err == nil && info.Size() > 0 {
+		this.spooled = true
+		this.spoolSize = info.Size()
+	}
+}
+
+//暂存文件已满时丢弃的消息数
+func (this *NetworkSink ) Dropped() int64 {
+	return atomic.LoadInt64(&this.dropped)
+}
+
+//未连接时按退避时间重连,连上之后补发暂存的消息
+func (this *NetworkSink ) reconnect() {
+	if this.conn == nil {
+		if time.Now().Before(this.nextDial) {
+			return
+		}
+		timeout := time.Duration(this.DialTimeout) * time.Millisecond
+		if timeout <= 0 {
+			timeout = 3 * time.Second
+		}
+		conn, err := net.DialTimeout(this.Network, this.Addr, timeout)
+		if err != nil {
+			this.fail()
+			return
+		}
+		this.conn = conn
+		this.backoff = 0
+	}
+	if this.spooled {
+		this.replay()
+	}
+}
+
+//连接失败,关闭连接并计算下次重连的时间
+func (this *NetworkSink ) fail() {
+	if this.conn != nil {
+		this.conn.Close()
+		this.conn = nil
+	}
+	this.backoff = nextBackoff(this.backoff, this.MinBackoff, this.MaxBackoff)
+	this.nextDial = time.Now().Add(this.backoff)
+}
+
+//下一次的重连间隔,从minBackoff开始每次翻倍,最大为maxBackoff,单位毫秒,默认100和30000
+func nextBackoff(backoff time.Duration, minBackoff, maxBackoff int) time.Duration {
+	min := time.Duration(minBackoff) * time.Millisecond
+	if min <= 0 {
+		min = 100 * time.Millisecond
+	}
+	max := time.Duration(maxBackoff) * time.Millisecond
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if backoff < min {
+		backoff = min
+	}else {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+//发送数据,失败时断开连接
+func (this *NetworkSink ) send(b []byte) error {
+	_, err := this.write(b)
+	return err
+}
+
+func (this *NetworkSink ) write(b []byte) (int, error) {
+	timeout := time.Duration(this.WriteTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	this.conn.SetWriteDeadline(time.Now().Add(timeout))
+	n, err := this.conn.Write(b)
+	if err != nil {
+		this.fail()
+	}
+	return n, err
+}
+
+//追加到暂存文件,超过大小上限时丢弃,只在刚满的时候返回错误
+func (this *NetworkSink ) spool(b []byte) error {
+	maxSize := int64(this.MaxSpoolSize) << 10
+	if maxSize == 0 {
+		maxSize = 100 << 20
+	}
+	if maxSize > 0 && this.spoolSize + int64(len(b)) > maxSize {
+		atomic.AddInt64(&this.dropped, 1)
+		if this.spoolFull {
+			return nil
+		}
+		this.spoolFull = true
+		return ErrSpoolFull
+	}
+	spoolPath := this.spoolPath()
+	os.MkdirAll(path.Dir(spoolPath), os.ModePerm)
+	fh, err := os.OpenFile(spoolPath, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(b)
+	if e := fh.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	this.spooled = true
+	this.spoolSize += int64(len(b))
+	return nil
+}
+
+/**
+ * 按顺序分块补发暂存的消息,记录完整发送的行的位置
+ * 发送失败时从没有完整发送的那一行开始保留,重连之后整行重发
+ * 断开的连接上可能留下半行,接收端应该丢弃连接关闭时不完整的最后一行
+ */
+func (this *NetworkSink ) replay() {
+	spoolPath := this.spoolPath()
+	fh, err := os.Open(spoolPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			this.resetSpool()
+		}
+		return
+	}
+	defer fh.Close()
+	r := bufio.NewReaderSize(fh, replayChunkSize)
+	var sent int64        //已经完整发送的字节数
+	var batch []byte
+	var batchSize int64   //batch在文件中对应的字节数
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if len(line) > 0 {
+			batchSize += int64(len(line))
+			batch = append(batch, line...)
+			//进程异常退出时最后一行可能没有换行
+			if line[len(line) - 1] != '\n' {
+				batch = append(batch, '\n')
+			}
+		}
+		if len(batch) > 0 && (len(batch) >= replayChunkSize || readErr != nil) {
+			n, err := this.write(batch)
+			if err != nil {
+				if i := bytes.LastIndexByte(batch[:n], '\n'); i >= 0 {
+					sent += int64(i + 1)
+				}
+				this.compactSpool(fh, sent)
+				return
+			}
+			sent += batchSize
+			batch = batch[:0]
+			batchSize = 0
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			this.compactSpool(fh, sent)
+			return
+		}
+	}
+	fh.Close()
+	os.Remove(spoolPath)
+	this.resetSpool()
+}
+
+func (this *NetworkSink ) resetSpool() {
+	this.spooled = false
+	this.spoolSize = 0
+	this.spoolFull = false
+}
+
+//去掉暂存文件中已经发送的内容
+func (this *NetworkSink ) compactSpool(fh *os.File, sent int64) {
+	if sent == 0 {
+		return
+	}
+	spoolPath := this.spoolPath()
+	if _, err := fh.Seek(sent, io.SeekStart); err != nil {
+		return
+	}
+	tmpPath := spoolPath + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	n, err := io.Copy(tmp, fh)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil || os.Rename(tmpPath, spoolPath) != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	this.spoolSize = n
+	this.spoolFull = false
+}
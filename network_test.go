@@ -0,0 +1,198 @@
+package flog
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//测试网络输出,断线时暂存,重连之后按顺序补发
+func TestNetworkSinkSpool(t *testing.T) {
+	//先占用一个端口再关掉,保证一开始连接失败
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	loger := New("/tmp/flog_network")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogFlags = []int{LF_CATE}
+	sink := NewNetworkSink("tcp", addr)
+	sink.MinBackoff = 10
+	sink.SpoolFile = "net.spool"
+	loger.AddSink(sink)
+	loger.SetAsync(10)
+	loger.Info("n", "msg1")
+	loger.Info("n", "msg2")
+	loger.Flush()
+
+	if !FileExist(path.Join(loger.LogPath, "net.spool")) {
+		t.Fatal("Messages were not spooled")
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("port was taken by others", err)
+	}
+	defer ln.Close()
+	time.Sleep(50 * time.Millisecond)
+	loger.Info("n", "msg3")
+	loger.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, expected := range []string{"n msg1", "n msg2", "n msg3"} {
+		line, _, err := r.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(line) != expected {
+			t.Fatal("Messages were not replayed in order.", string(line))
+		}
+	}
+	if FileExist(path.Join(loger.LogPath, "net.spool")) {
+		t.Fatal("Spool file should be removed after replay")
+	}
+}
+
+//测试关闭时补发,以及分块补发大的暂存文件
+func TestNetworkSinkReplayOnClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	loger := New("/tmp/flog_network_close")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogFlags = []int{LF_CATE}
+	sink := NewNetworkSink("tcp", addr)
+	//退避时间很长,只有关闭时才会重连
+	sink.MinBackoff = 60000
+	sink.SpoolFile = "net.spool"
+	loger.AddSink(sink)
+	line := strings.Repeat("x", 100)
+	total := 2000
+	for i := 0; i < total; i++ {
+		loger.Info("n", strconv.Itoa(i), line)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("port was taken by others", err)
+	}
+	defer ln.Close()
+	received := make(chan int)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- 0
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		r := bufio.NewReader(conn)
+		n := 0
+		for {
+			l, _, err := r.ReadLine()
+			if err != nil || string(l) != "n " + strconv.Itoa(n) + " " + line {
+				break
+			}
+			n++
+		}
+		received <- n
+	}()
+	loger.Close()
+	if n := <-received; n != total {
+		t.Fatal("Spooled messages were not replayed in order on close.", n, total)
+	}
+	if FileExist(path.Join(loger.LogPath, "net.spool")) {
+		t.Fatal("Spool file should be removed after replay")
+	}
+}
+
+//测试暂存文件的大小上限
+func TestNetworkSinkMaxSpoolSize(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	loger := New("/tmp/flog_network_max")
+	defer os.RemoveAll(loger.LogPath)
+	var errs []error
+	loger.ErrorHandler = func(op string, err error) {
+		errs = append(errs, err)
+	}
+	sink := NewNetworkSink("tcp", addr)
+	sink.MinBackoff = 60000
+	sink.MaxSpoolSize = 1
+	sink.SpoolFile = "net.spool"
+	loger.AddSink(sink)
+	for i := 0; i < 100; i++ {
+		loger.Info("n", strings.Repeat("x", 100))
+	}
+	info, err := os.Stat(path.Join(loger.LogPath, "net.spool"))
+	if err != nil || info.Size() > 1 << 10 {
+		t.Fatal("Spool file should be capped at 1KB", info, err)
+	}
+	if sink.Dropped() == 0 || len(errs) != 1 || !errors.Is(errs[0], ErrSpoolFull) {
+		t.Fatal("Spool full should be reported once.", sink.Dropped(), errs)
+	}
+}
+
+//测试重新加载配置修改LogPath时暂存文件不移动
+func TestNetworkSinkApplyConfig(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dirs := []string{"/tmp/flog_network_reload1", "/tmp/flog_network_reload2"}
+	for _, dir := range dirs {
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+	}
+	loger := New(dirs[0])
+	sink := NewNetworkSink("tcp", addr)
+	sink.MinBackoff = 10
+	sink.SpoolFile = "net.spool"
+	loger.AddSink(sink)
+	loger.SetAsync(10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			loger.Info("n", "msg")
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := loger.ApplyConfig(&Config{LogPath:dirs[i % 2]}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+	loger.Close()
+	if !FileExist(path.Join(dirs[0], "net.spool")) || FileExist(path.Join(dirs[1], "net.spool")) {
+		t.Fatal("Spool file should stay in the first log path")
+	}
+}
@@ -0,0 +1,90 @@
+package flog
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+//写入异步队列,队列满时按OverflowPolicy处理
+func (this *Flog ) enqueue(msg *LogMsg) {
+	select {
+	case this.msgChan <- msg:
+		return
+	default:
+	}
+
+	switch this.OverflowPolicy {
+	case OVERFLOW_BLOCK_TIMEOUT:
+		timeout := this.OverflowTimeout
+		if timeout <= 0 {
+			timeout = 100
+		}
+		timer := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case this.msgChan <- msg:
+		case <-timer.C:
+			atomic.AddInt64(&this.dropped, 1)
+		}
+	case OVERFLOW_DROP_NEWEST:
+		atomic.AddInt64(&this.dropped, 1)
+	case OVERFLOW_DROP_OLDEST:
+		for {
+			select {
+			case this.msgChan <- msg:
+				return
+			default:
+			}
+			select {
+			case <-this.msgChan:
+				atomic.AddInt64(&this.dropped, 1)
+			default:
+			}
+		}
+	case OVERFLOW_DROP_BELOW_LEVEL:
+		if msg.Level < this.OverflowLevel {
+			atomic.AddInt64(&this.dropped, 1)
+			return
+		}
+		this.msgChan <- msg
+	default:
+		this.msgChan <- msg
+	}
+}
+
+//异步队列满时丢弃的消息总数
+func (this *Flog ) Dropped() int64 {
+	return atomic.LoadInt64(&this.dropped)
+}
+
+/**
+ * 把新丢弃的消息数作为一条警告写入日志,让丢失的日志可见
+ * 在collect的goroutine中调用,每DropReportInterval秒最多写一次,force为true时立即写
+ */
+func (this *Flog ) reportDropped(force bool) {
+	dropped := atomic.LoadInt64(&this.dropped)
+	if dropped == this.reportedDropped {
+		return
+	}
+	interval := this.DropReportInterval
+	if interval <= 0 {
+		interval = 60
+	}
+	now := time.Now()
+	if !force && now.Sub(this.lastDropReport) < time.Duration(interval) * time.Second {
+		return
+	}
+	msg := &LogMsg{
+		Time:now,
+		Level:LEVEL_WARNING,
+		Category:"flog",
+		Message:"dropped " + strconv.FormatInt(dropped - this.reportedDropped, 10) + " messages because the async queue was full",
+		Fields:[]Field{F("dropped_total", dropped)},
+		File:"flog",
+	}
+	msg.formatMsg = this.format(this.getFormatter(), msg)
+	this.reportedDropped = dropped
+	this.lastDropReport = now
+	this.dispatch(msg)
+}
@@ -0,0 +1,72 @@
+package flog
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+//写入时阻塞直到放行的sink,用来让异步队列堆满
+type blockingSink struct {
+	MemorySink
+	started chan bool
+	release chan bool
+}
+
+func (this *blockingSink ) Write(msg *LogMsg) error {
+	if msg.Message == "block\n" {
+		this.started <- true
+		<-this.release
+	}
+	return this.MemorySink.Write(msg)
+}
+
+//测试队列满时丢弃消息,并把丢弃数写入日志
+func TestOverflowDropNewest(t *testing.T) {
+	loger := New("/tmp/flog_overflow")
+	defer os.RemoveAll(loger.LogPath)
+	loger.DisableFileLog = true
+	sink := &blockingSink{started:make(chan bool), release:make(chan bool)}
+	loger.AddSink(sink)
+	loger.OverflowPolicy = OVERFLOW_DROP_NEWEST
+	loger.SetAsync(1)
+
+	loger.Info("o", "block")
+	<-sink.started
+	loger.Info("o", "queued")
+	loger.Info("o", "dropped")
+	loger.Info("o", "dropped")
+	close(sink.release)
+	loger.Close()
+
+	if loger.Dropped() != 2 {
+		t.Fatal("Dropped should be 2,", loger.Dropped())
+	}
+	msgs := sink.Messages()
+	if len(msgs) != 3 || msgs[1].Message != "queued\n" || !strings.HasPrefix(msgs[2].Message, "dropped 2 messages") {
+		t.Fatal("Messages do not show as expected.", msgs)
+	}
+}
+
+//测试队列满时丢弃最早的消息
+func TestOverflowDropOldest(t *testing.T) {
+	loger := New("/tmp/flog_overflow2")
+	defer os.RemoveAll(loger.LogPath)
+	loger.DisableFileLog = true
+	sink := &blockingSink{started:make(chan bool), release:make(chan bool)}
+	loger.AddSink(sink)
+	loger.OverflowPolicy = OVERFLOW_DROP_OLDEST
+	loger.SetAsync(1)
+
+	loger.Info("o", "block")
+	<-sink.started
+	loger.Info("o", "old")
+	loger.Info("o", "new")
+	close(sink.release)
+	loger.Close()
+
+	msgs := sink.Messages()
+	if len(msgs) != 3 || msgs[1].Message != "new\n" {
+		t.Fatal("Messages do not show as expected.", msgs)
+	}
+}
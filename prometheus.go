@@ -0,0 +1,107 @@
+package flog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * 以Prometheus的文本格式输出统计数据,eg. http.Handle("/metrics", loger.MetricsHandler())
+ * 不依赖Prometheus的客户端库,指标名以flog_开头
+ *
+ * @return http.Handler
+ *
+ */
+func (this *Flog ) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(this.renderMetrics())
+	})
+}
+
+//按Prometheus的文本格式生成所有指标
+func (this *Flog ) renderMetrics() []byte {
+	stats := this.Stats()
+	var buf bytes.Buffer
+	writeMetricMap(&buf, "flog_messages_total", "counter", "Messages logged by level.", "level", stats.Levels)
+	writeMetricMap(&buf, "flog_category_messages_total", "counter", "Messages logged by category.", "category", stats.Categories)
+	writeMetricMap(&buf, "flog_written_bytes_total", "counter", "Bytes written by log file, keyed by the name without the date suffix.", "file", stats.Bytes)
+	writeMetricMap(&buf, "flog_errors_total", "counter", "Internal errors by operation.", "op", stats.Errors)
+	writeMetric(&buf, "flog_written_messages_total", "counter", "Messages written to log files.", float64(stats.Written))
+	writeMetric(&buf, "flog_write_failures_total", "counter", "Messages that failed to be written to log files.", float64(stats.WriteFailed))
+	writeMetric(&buf, "flog_write_latency_avg_seconds", "gauge", "Average time from the log call to the file write.", stats.LatencyAvg.Seconds())
+	writeMetric(&buf, "flog_write_latency_max_seconds", "gauge", "Maximum time from the log call to the file write.", stats.LatencyMax.Seconds())
+	writeMetric(&buf, "flog_rotations_total", "counter", "Log file rotations.", float64(stats.Rotations))
+	writeMetric(&buf, "flog_archive_runs_total", "counter", "Archive runs.", float64(stats.Archives))
+	writeMetric(&buf, "flog_queue_depth", "gauge", "Messages waiting in the async queue.", float64(stats.QueueDepth))
+	writeMetric(&buf, "flog_queue_capacity", "gauge", "Capacity of the async queue.", float64(stats.QueueCapacity))
+	writeMetric(&buf, "flog_dropped_total", "counter", "Messages dropped because the async queue was full.", float64(stats.Dropped))
+	if age, ok := this.oldestArchiveAge(); ok {
+		writeMetric(&buf, "flog_oldest_archive_age_seconds", "gauge", "Age of the oldest file in the archive directory.", age.Seconds())
+	}
+	return buf.Bytes()
+}
+
+//归档目录下最旧的文件距今的时间,没有开启归档或者没有归档文件时返回false
+func (this *Flog ) oldestArchiveAge() (time.Duration, bool) {
+	conf := this.loadFileConf()
+	if !conf.needArchive {
+		return 0, false
+	}
+	files, err := ioutil.ReadDir(conf.archiveDir())
+	if err != nil {
+		return 0, false
+	}
+	var oldest time.Time
+	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".tmp") {
+			continue
+		}
+		if oldest.IsZero() || f.ModTime().Before(oldest) {
+			oldest = f.ModTime()
+		}
+	}
+	if oldest.IsZero() {
+		return 0, false
+	}
+	return time.Since(oldest), true
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, typ, help string) {
+	buf.WriteString("# HELP " + name + " " + help + "\n")
+	buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeMetric(buf *bytes.Buffer, name, typ, help string, value float64) {
+	writeMetricHeader(buf, name, typ, help)
+	buf.WriteString(name + " " + formatMetricValue(value) + "\n")
+}
+
+//输出带一个label的指标,按label排序保证输出稳定
+func writeMetricMap(buf *bytes.Buffer, name, typ, help, label string, values map[string]int64) {
+	writeMetricHeader(buf, name, typ, help)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteString(name + "{" + label + "=\"" + escapeLabelValue(k) + "\"} " + strconv.FormatInt(values[k], 10) + "\n")
+	}
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+//label的值需要转义反斜杠,双引号和换行
+var labelReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabelValue(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,51 @@
+package flog
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+//测试Prometheus格式的指标输出
+func TestMetricsHandler(t *testing.T) {
+	loger := New("/tmp/flog_metrics")
+	os.RemoveAll(loger.LogPath)
+	defer os.RemoveAll(loger.LogPath)
+	loger.NeedArchive = true
+	loger.Info("db", "info_message")
+	loger.Info("say \"hi\"", "info_message")
+	loger.Error("db", "error_message")
+	touchLogFile(t, path.Join(loger.getArchiveDir(), "old.log"), 10, time.Now().Add(-time.Hour))
+
+	server := httptest.NewServer(loger.MetricsHandler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatal("Content-Type is wrong.", resp.Header.Get("Content-Type"))
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	text := string(body)
+	for _, want := range []string{
+		"# TYPE flog_messages_total counter\n",
+		"flog_messages_total{level=\"error\"} 1\n",
+		"flog_messages_total{level=\"info\"} 2\n",
+		"flog_category_messages_total{category=\"db\"} 2\n",
+		"flog_category_messages_total{category=\"say \\\"hi\\\"\"} 1\n",
+		"flog_written_messages_total 3\n",
+		"flog_queue_depth 0\n",
+		"flog_rotations_total 0\n",
+		"# TYPE flog_oldest_archive_age_seconds gauge\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("Metrics should contain %q, got:\n%s", want, text)
+		}
+	}
+}
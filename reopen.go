@@ -0,0 +1,110 @@
+package flog
+
+import (
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+)
+
+/**
+ * 关闭并重新打开所有的日志文件
+ * 用于配合系统的logrotate(create模式),logrotate重命名文件之后调用,之后的日志写入新建的文件
+ * 与写日志使用同一把锁,异步模式下collect正在写的消息会在重新打开之前写完
+ *
+ * @return error 重新打开失败的错误,失败的文件会在下次写日志时再次尝试打开
+ *
+ */
+func (this *Flog ) Reopen() error {
+	this.init()
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	filenames := make([]string, 0, len(this.fhMap))
+	for filename := range this.fhMap {
+		filenames = append(filenames, filename)
+	}
+	err := this.closeFiles()
+	for _, filename := range filenames {
+		if e := this.createFileHandleAndFlogger(filename, path.Join(this.LogPath, filename)); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+//关闭所有打开的文件,需要持有锁
+func (this *Flog ) closeFiles() error {
+	var err error
+	for filename, fh := range this.fhMap {
+		if e := this.flushBuffer(filename); e != nil {
+			err = e
+		}
+		if e := fh.Close(); e != nil {
+			err = e
+		}
+		//只删除key,不替换map,init中不加锁判断map是否为nil
+		delete(this.fhMap, filename)
+		delete(this.logerMap, filename)
+		delete(this.fileTimeMap, filename)
+		delete(this.checkTimeMap, filename)
+		delete(this.bufMap, filename)
+		delete(this.sizeMap, filename)
+		delete(this.infoMap, filename)
+	}
+	return err
+}
+
+/**
+ * 文件是否需要重新打开,文件被删除或者路径指向了其他文件(被移动,被其他进程切割)时返回true
+ * 按LogCheckInterval的间隔检查,避免每次写入都stat文件,多进程时每次写入都检查
+ */
+func (this *Flog ) needReopen(filename string, fh *os.File, filePath string) bool {
+	if !this.MultiProcess {
+		if this.LogCheckInterval < 0 {
+			return false
+		}
+		now := time.Now()
+		if now.Sub(this.checkTimeMap[filename]) < time.Duration(this.LogCheckInterval) * time.Millisecond {
+			return false
+		}
+		this.checkTimeMap[filename] = now
+	}
+	return !this.sameFile(filename, fh, filePath)
+}
+
+/**
+ * 收到信号时重新打开所有的日志文件,默认为SIGHUP,Close时停止
+ * eg. logrotate 配置 postrotate kill -HUP <pid>
+ *
+ * @param sig ...os.Signal 信号
+ * @return *Flog
+ *
+ */
+func (this *Flog ) ReopenOnSignal(sig ...os.Signal) *Flog {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	this.stopReopenSignal()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	this.reopenSignal = ch
+	go func() {
+		for range ch {
+			if err := this.Reopen(); err != nil {
+				this.handleError("reopen", err)
+			}
+		}
+	}()
+	return this
+}
+
+//停止监听重新打开文件的信号
+func (this *Flog ) stopReopenSignal() {
+	if this.reopenSignal == nil {
+		return
+	}
+	signal.Stop(this.reopenSignal)
+	close(this.reopenSignal)
+	this.reopenSignal = nil
+}
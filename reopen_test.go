@@ -0,0 +1,70 @@
+package flog
+
+import (
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//测试外部重命名文件之后重新打开
+func TestReopen(t *testing.T) {
+	loger := New("/tmp/flog_reopen")
+	defer os.RemoveAll(loger.LogPath)
+	filename := path.Join(loger.LogPath, loger.FileName)
+	loger.Debug("d", "before")
+	//模拟logrotate重命名
+	os.Rename(filename, filename + ".1")
+	if err := loger.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	loger.Debug("d", "after")
+
+	b, _ := os.ReadFile(filename)
+	if !strings.Contains(string(b), "after") || strings.Contains(string(b), "before") {
+		t.Fatal("Logs were not written to the new file.", string(b))
+	}
+}
+
+//测试收到SIGHUP之后重新打开
+func TestReopenOnSignal(t *testing.T) {
+	loger := New("/tmp/flog_reopen_signal")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetAsync(10)
+	loger.ReopenOnSignal()
+	defer loger.Close()
+	filename := path.Join(loger.LogPath, loger.FileName)
+	loger.Debug("d", "before")
+	loger.Flush()
+	os.Rename(filename, filename + ".1")
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(syscall.SIGHUP)
+	for i := 0; i < 100 && !FileExist(filename); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !FileExist(filename) {
+		t.Fatal("File was not reopened after SIGHUP")
+	}
+}
+
+//测试文件被删除之后自动重新创建
+func TestRecreateDeletedFile(t *testing.T) {
+	loger := New("/tmp/flog_recreate")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogCheckInterval = 10
+	filename := path.Join(loger.LogPath, loger.FileName)
+	loger.Debug("d", "before")
+	os.Remove(filename)
+	time.Sleep(20 * time.Millisecond)
+	loger.Debug("d", "after")
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "after") {
+		t.Fatal("Logs were not written to the recreated file.", string(b))
+	}
+}
@@ -0,0 +1,206 @@
+package flog
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+//清理时用到的文件信息
+type logFileInfo struct {
+	path string
+	info os.FileInfo
+}
+
+/**
+ * 执行所有的保留策略,可以组合使用
+ * LogKeepDay 删除归档目录下超过保留天数的文件
+ * LogKeepCount 每个日志最多保留的切割文件数,超过时删除最旧的
+ * LogMaxTotalSize LogPath和归档目录下日志文件的总大小上限,超过时从最旧的开始删除
+ * 正在写入的文件以及不属于任何日志的文件不会被删除
+ */
+func (this *Flog ) cleanup(conf *fileConf) {
+	//同时只有一个清理在执行
+	if !atomic.CompareAndSwapInt32(&this.cleaning, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&this.cleaning, 0)
+
+	archiveDir := conf.archiveDir()
+	if conf.needArchive {
+		this.delLogFiles(conf)
+	}
+	if conf.logKeepCount <= 0 && conf.logMaxTotalSize <= 0 {
+		return
+	}
+
+	//正在写入的文件和日志名,其他进程可能在写当前周期的文件,也不能删除
+	this.mu.Lock()
+	live := make(map[string]bool, len(this.fhMap))
+	for filename := range this.fhMap {
+		live[path.Join(conf.logPath, filename)] = true
+	}
+	names := make([]string, 0, len(this.logNames))
+	for name := range this.logNames {
+		names = append(names, name)
+		live[path.Join(conf.logPath, name)] = true
+		if len(conf.dateFormat) > 0 {
+			live[path.Join(conf.logPath, name + "." + Date(conf.dateFormat))] = true
+		}
+	}
+	this.mu.Unlock()
+
+	files := listLogFiles(conf.logPath)
+	if archiveDir != conf.logPath {
+		files = append(files, listLogFiles(archiveDir)...)
+	}
+	if conf.logKeepCount > 0 {
+		files = this.keepByCount(conf, files, live, names)
+	}
+	if conf.logMaxTotalSize > 0 {
+		this.keepByTotalSize(conf, files, live, names)
+	}
+}
+
+//列出目录下的日志文件,忽略目录,隐藏文件和临时文件
+func listLogFiles(dir string) []logFileInfo {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	files := make([]logFileInfo, 0, len(infos))
+	for _, f := range infos {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || strings.HasSuffix(f.Name(), ".tmp") {
+			continue
+		}
+		files = append(files, logFileInfo{path:path.Join(dir, f.Name()), info:f})
+	}
+	return files
+}
+
+//每个日志只保留最新的LogKeepCount个切割文件,返回剩下的文件
+func (this *Flog ) keepByCount(conf *fileConf, files []logFileInfo, live map[string]bool, names []string) []logFileInfo {
+	//按最长匹配把切割文件分到对应的日志名下 eg. flog.log.debug.1530 属于 flog.log.debug 而不是 flog.log
+	groups := make(map[string][]logFileInfo)
+	rest := make([]logFileInfo, 0, len(files))
+	for _, f := range files {
+		if live[f.path] {
+			rest = append(rest, f)
+			continue
+		}
+		owner := conf.ownerOf(f.info.Name(), names)
+		if len(owner) == 0 {
+			rest = append(rest, f)
+			continue
+		}
+		groups[owner] = append(groups[owner], f)
+	}
+
+	for _, group := range groups {
+		sortByModTime(group)
+		//最新的在最后
+		del := len(group) - conf.logKeepCount
+		for i, f := range group {
+			if i < del {
+				if err := os.Remove(f.path); err != nil {
+					this.handleError("cleanup", err)
+				}
+				continue
+			}
+			rest = append(rest, f)
+		}
+	}
+	return rest
+}
+
+//文件所属的日志名,有多个时取最长的,不属于任何日志时返回空
+func (this *fileConf ) ownerOf(filename string, names []string) string {
+	owner := ""
+	for _, name := range names {
+		if len(name) > len(owner) && this.isLogFileOf(filename, name) {
+			owner = name
+		}
+	}
+	return owner
+}
+
+/**
+ * 文件是否是日志name或者它的切割和归档文件
+ * 后缀只能是日期,时间和序号,可以带压缩的扩展名 eg. app.log app.log.1530 app.log.20160410.gz app.1530.1.log
+ * 其他分类的文件不会被当成name的文件 eg. db.query 不属于 db
+ *
+ * @param filename string 文件名
+ * @param name string 不带日期的日志名
+ * @return bool
+ *
+ */
+func (this *fileConf ) isLogFileOf(filename, name string) bool {
+	if cext := this.compressExt(); len(cext) > 0 {
+		filename = strings.TrimSuffix(filename, cext)
+	}
+	if filename == name {
+		return true
+	}
+	if strings.HasPrefix(filename, name + ".") && isRotateSuffix(filename[len(name) + 1:]) {
+		return true
+	}
+	if this.rotateKeepExt {
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		return len(ext) > 0 && len(filename) > len(name) + 1 && strings.HasPrefix(filename, base + ".") &&
+			strings.HasSuffix(filename, ext) && isRotateSuffix(filename[len(base) + 1:len(filename) - len(ext)])
+	}
+	return false
+}
+
+//后缀是否由日期,时间和序号组成,以.分隔 eg. 20160410.1530.1 2016-04-10
+func isRotateSuffix(suffix string) bool {
+	for _, part := range strings.Split(suffix, ".") {
+		if len(part) == 0 || strings.Trim(part, "0123456789-_: ") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+//总大小超过LogMaxTotalSize时从最旧的文件开始删除,只统计和删除日志的文件
+func (this *Flog ) keepByTotalSize(conf *fileConf, files []logFileInfo, live map[string]bool, names []string) {
+	maxSize := int64(conf.logMaxTotalSize) << 20
+	logFiles := make([]logFileInfo, 0, len(files))
+	var total int64
+	for _, f := range files {
+		if len(conf.ownerOf(f.info.Name(), names)) == 0 {
+			continue
+		}
+		logFiles = append(logFiles, f)
+		total += f.info.Size()
+	}
+	files = logFiles
+	if total <= maxSize {
+		return
+	}
+	sortByModTime(files)
+	for _, f := range files {
+		if total <= maxSize {
+			break
+		}
+		if live[f.path] {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			this.handleError("cleanup", err)
+			continue
+		}
+		total -= f.info.Size()
+	}
+}
+
+//按修改时间从旧到新排序
+func sortByModTime(files []logFileInfo) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].info.ModTime().Before(files[j].info.ModTime())
+	})
+}
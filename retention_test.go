@@ -0,0 +1,129 @@
+package flog
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//创建一个指定修改时间的文件
+func touchLogFile(t *testing.T, filename string, size int, mtime time.Time) {
+	os.MkdirAll(path.Dir(filename), os.ModePerm)
+	if err := os.WriteFile(filename, []byte(strings.Repeat("x", size)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filename, mtime, mtime)
+}
+
+//等待后台清理完成
+func waitCleanup(filename string) {
+	for i := 0; i < 100 && FileExist(filename); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+//测试按切割文件数保留
+func TestLogKeepCount(t *testing.T) {
+	loger := New("/tmp/flog_keep_count")
+	defer os.RemoveAll(loger.LogPath)
+	loger.FileName = "app.log"
+	loger.LogRotateSize = 1
+	loger.LogKeepCount = 2
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		touchLogFile(t, path.Join(loger.LogPath, "app.log." + strconv.Itoa(i)), 10, now.Add(time.Duration(i - 10) * time.Hour))
+	}
+	//其他日志的文件不受影响
+	touchLogFile(t, path.Join(loger.LogPath, "other.log.1"), 10, now.Add(-20 * time.Hour))
+
+	loger.Debug("d", strings.Repeat("y", 1100))
+	loger.Debug("d", "rotate")
+	waitCleanup(path.Join(loger.LogPath, "app.log.3"))
+
+	for name, exist := range map[string]bool{"app.log.1":false, "app.log.2":false, "app.log.3":false, "app.log.4":true, "other.log.1":true, "app.log":true} {
+		if FileExist(path.Join(loger.LogPath, name)) != exist {
+			t.Fatal(name, "exist should be", exist)
+		}
+	}
+}
+
+//测试按总大小保留
+func TestLogMaxTotalSize(t *testing.T) {
+	loger := New("/tmp/flog_total_size")
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogRotateSize = 1
+	loger.LogMaxTotalSize = 1
+	now := time.Now()
+	touchLogFile(t, path.Join(loger.LogPath, "flog.log.1"), 700 << 10, now.Add(-3 * time.Hour))
+	touchLogFile(t, path.Join(loger.LogPath, loger.ArchivePath, "flog.log.20160410"), 700 << 10, now.Add(-4 * time.Hour))
+	touchLogFile(t, path.Join(loger.LogPath, "flog.log.2"), 700 << 10, now.Add(-1 * time.Hour))
+	//不是日志创建的文件不统计也不删除
+	touchLogFile(t, path.Join(loger.LogPath, "notes.txt"), 700 << 10, now.Add(-5 * time.Hour))
+
+	loger.Debug("d", strings.Repeat("y", 1100))
+	loger.Debug("d", "rotate")
+	waitCleanup(path.Join(loger.LogPath, "flog.log.1"))
+
+	if FileExist(path.Join(loger.LogPath, loger.ArchivePath, "flog.log.20160410")) || FileExist(path.Join(loger.LogPath, "flog.log.1")) {
+		t.Fatal("Oldest files should be deleted")
+	}
+	if !FileExist(path.Join(loger.LogPath, "flog.log.2")) || !FileExist(path.Join(loger.LogPath, loger.FileName)) {
+		t.Fatal("Newest files should be kept")
+	}
+	if !FileExist(path.Join(loger.LogPath, "notes.txt")) {
+		t.Fatal("Files not created by the logger should be kept")
+	}
+}
+
+//测试带.的分类,db.query 的文件不属于 db
+func TestLogKeepCountDottedCategory(t *testing.T) {
+	loger := New("/tmp/flog_keep_dotted")
+	os.RemoveAll(loger.LogPath)
+	defer os.RemoveAll(loger.LogPath)
+	loger.LogMode = LOGMODE_CATE
+	loger.LogRotateSize = 1
+	loger.LogKeepCount = 1
+	loger.LogRotateNaming = ROTATENAME_SEQ
+	now := time.Now()
+	//其他进程正在写的db.query以及它的切割文件
+	touchLogFile(t, path.Join(loger.LogPath, "db.query"), 10, now.Add(-5 * time.Hour))
+	touchLogFile(t, path.Join(loger.LogPath, "db.query.1"), 10, now.Add(-6 * time.Hour))
+	touchLogFile(t, path.Join(loger.LogPath, "db.1"), 10, now.Add(-4 * time.Hour))
+	touchLogFile(t, path.Join(loger.LogPath, "db.2"), 10, now.Add(-3 * time.Hour))
+
+	loger.Debug("db", strings.Repeat("y", 1100))
+	loger.Debug("db", "rotate")
+	waitCleanup(path.Join(loger.LogPath, "db.2"))
+
+	for name, exist := range map[string]bool{"db.1":false, "db.2":false, "db.3":true, "db":true, "db.query":true, "db.query.1":true} {
+		if FileExist(path.Join(loger.LogPath, name)) != exist {
+			t.Fatal(name, "exist should be", exist)
+		}
+	}
+}
+
+//测试切割文件的匹配
+func TestIsLogFileOf(t *testing.T) {
+	conf := &fileConf{rotateKeepExt:true, compressor:&GzipCompressor{}}
+	cases := map[string]bool{
+		"app.log":true,
+		"app.log.1530":true,
+		"app.log.20160410.1530.2":true,
+		"app.log.2016-04-10.gz":true,
+		"app.20160410.1.log":true,
+		"app.20160410.1.log.gz":true,
+		"app.log.debug":false,
+		"app.log.bak":false,
+		"app.log.":false,
+		"app.xlog":false,
+		"app.1.txt":false,
+	}
+	for filename, expected := range cases {
+		if conf.isLogFileOf(filename, "app.log") != expected {
+			t.Fatal(filename, "should be", expected)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package flog
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+/**
+ * 日志输出目标
+ * 同步模式下Write会被多个goroutine同时调用,实现需要保证并发安全
+ * 异步模式下Write Flush都在collect的goroutine中调用
+ */
+type Sink interface {
+	Write(msg *LogMsg) error
+	Flush() error
+	Close() error
+}
+
+/**
+ * 添加一个输出目标,一条日志会同时写到文件和所有添加的目标
+ * 可以在写日志的同时调用,添加之后的日志才会写到该目标
+ *
+ * @param sink Sink
+ * @return *Flog
+ *
+ */
+func (this *Flog ) AddSink(sink Sink) *Flog {
+	this.init()
+	if b, ok := sink.(flogBinder); ok {
+		b.bindFlog(this)
+	}
+	this.confMu.Lock()
+	defer this.confMu.Unlock()
+	old := this.getSinks()
+	sinks := make([]Sink, len(old), len(old) + 1)
+	copy(sinks, old)
+	this.sinks.Store(append(sinks, sink))
+	return this
+}
+
+//获取所有的输出目标,不需要加锁
+func (this *Flog ) getSinks() []Sink {
+	sinks, _ := this.sinks.Load().([]Sink)
+	return sinks
+}
+
+//需要读取Flog配置(eg. LogPath)的内置Sink实现该接口
+type flogBinder interface {
+	bindFlog(flog *Flog)
+}
+
+//按Flog的Formatter格式化之后的内容,自定义的Sink可以直接使用
+func (msg *LogMsg) Formatted() string {
+	return msg.formatMsg
+}
+
+/**
+ * 内置的文件输出,使用Flog自己的LogPath LogMode FileName以及切割和归档的配置
+ * 每个Flog只有一个文件输出,需要写到其他目录或者使用其他LogMode时,创建另一个Flog
+ */
+type fileSink struct {
+	flog *Flog
+}
+
+func (this *fileSink ) Write(msg *LogMsg) error {
+	if this.flog.DisableFileLog {
+		return nil
+	}
+	this.flog.writeMsg(msg)
+	return nil
+}
+
+func (this *fileSink ) Flush() error {
+	return this.flog.flushBuffers()
+}
+
+//关闭所有打开的文件,再次写日志时会重新打开
+func (this *fileSink ) Close() error {
+	this.flog.mu.Lock()
+	defer this.flog.mu.Unlock()
+	return this.flog.closeFiles()
+}
+
+/**
+ * 输出到任意io.Writer,eg. os.Stderr, bytes.Buffer, net.Conn
+ * Formatter为空时使用Flog的Formatter格式化之后的内容
+ */
+type WriterSink struct {
+	mu        sync.Mutex
+	Writer    io.Writer
+	Formatter Formatter
+}
+
+func NewWriterSink(w io.Writer, formatter Formatter) *WriterSink {
+	return &WriterSink{Writer:w, Formatter:formatter}
+}
+
+func (this *WriterSink ) Write(msg *LogMsg) error {
+	b := []byte(msg.formatMsg)
+	if this.Formatter != nil {
+		var err error
+		if b, err = this.Formatter.Format(msg); err != nil {
+			return err
+		}
+	}
+	if len(b) == 0 || b[len(b) - 1] != '\n' {
+		b = append(b, '\n')
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	_, err := this.Writer.Write(b)
+	return err
+}
+
+func (this *WriterSink ) Flush() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if f, ok := this.Writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (this *WriterSink ) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if c, ok := this.Writer.(io.Closer); ok && c != os.Stdout && c != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+/**
+ * 把日志保存在内存中,可用于测试或者在程序里查看最近的日志
+ * Max大于0时只保留最近的Max条
+ */
+type MemorySink struct {
+	mu   sync.Mutex
+	Max  int
+	msgs []LogMsg
+}
+
+func (this *MemorySink ) Write(msg *LogMsg) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.msgs = append(this.msgs, *msg)
+	if this.Max > 0 && len(this.msgs) > this.Max {
+		this.msgs = this.msgs[len(this.msgs) - this.Max:]
+	}
+	return nil
+}
+
+func (this *MemorySink ) Flush() error {
+	return nil
+}
+
+func (this *MemorySink ) Close() error {
+	return nil
+}
+
+//获取内存中的日志
+func (this *MemorySink ) Messages() []LogMsg {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	msgs := make([]LogMsg, len(this.msgs))
+	copy(msgs, this.msgs)
+	return msgs
+}
@@ -0,0 +1,79 @@
+package flog
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+//测试多个输出目标
+func TestSinks(t *testing.T) {
+	loger := New("/tmp/flog_sinks")
+	defer os.RemoveAll(loger.LogPath)
+	mem := &MemorySink{}
+	var buf bytes.Buffer
+	loger.AddSink(mem).AddSink(NewWriterSink(&buf, &TextFormatter{Flags:[]int{LF_LEVEL}}))
+	loger.Info("s", "to all sinks")
+	loger.Close()
+
+	if !FileExist(path.Join(loger.LogPath, loger.FileName)) {
+		t.Fatal("File sink was not written")
+	}
+	msgs := mem.Messages()
+	if len(msgs) != 1 || msgs[0].Category != "s" || msgs[0].Level != LEVEL_INFO {
+		t.Fatal("Memory sink does not work as expected.", msgs)
+	}
+	if buf.String() != "INFO to all sinks\n" {
+		t.Fatal("Writer sink does not work as expected.", buf.String())
+	}
+}
+
+//测试关闭文件输出
+func TestDisableFileLog(t *testing.T) {
+	loger := New("/tmp/flog_sinks2")
+	defer os.RemoveAll(loger.LogPath)
+	loger.DisableFileLog = true
+	mem := &MemorySink{}
+	loger.AddSink(mem)
+	loger.SetAsync(10)
+	loger.Debug("s", "only memory")
+	loger.Close()
+
+	if FileExist(path.Join(loger.LogPath, loger.FileName)) {
+		t.Fatal("File sink should be disabled")
+	}
+	msgs := mem.Messages()
+	if len(msgs) != 1 || !strings.HasPrefix(msgs[0].Message, "only memory") {
+		t.Fatal("Memory sink does not work as expected.", msgs)
+	}
+}
+
+//测试写日志的同时添加输出目标
+func TestAddSinkConcurrent(t *testing.T) {
+	loger := New("/tmp/flog_sinks3")
+	defer os.RemoveAll(loger.LogPath)
+	loger.SetAsync(100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			loger.Info("s", "message")
+		}
+	}()
+	mems := make([]*MemorySink, 10)
+	for i := range mems {
+		mems[i] = &MemorySink{}
+		loger.AddSink(mems[i])
+	}
+	<-done
+	loger.Info("s", "last")
+	loger.Close()
+	for _, mem := range mems {
+		msgs := mem.Messages()
+		if len(msgs) == 0 || !strings.HasPrefix(msgs[len(msgs) - 1].Message, "last") {
+			t.Fatal("Sink added at runtime did not receive messages.", len(msgs))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package flog
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//日志的统计数据
+type metrics struct {
+	mu           sync.Mutex
+	levels       map[int]int64    //level:日志数
+	categories   map[string]int64 //category:日志数
+	bytes        map[string]int64 //不带日期的日志名:写入的字节数
+	errors       map[string]int64 //op:内部错误数
+	written      int64            //写入文件的日志数
+	writeFailed  int64            //打开或写入文件失败的日志数
+	latencyTotal time.Duration    //从调用到写入文件的总耗时
+	latencyMax   time.Duration    //从调用到写入文件的最大耗时
+	rotations    int64            //切割次数
+	archives     int64            //归档次数
+}
+
+//统计数据的快照
+type Stats struct {
+	Levels        map[string]int64 `json:"levels"`         //每个等级的日志数
+	Categories    map[string]int64 `json:"categories"`     //每个分类的日志数
+	Bytes         map[string]int64 `json:"bytes"`          //每个日志写入的字节数,按不带日期的日志名统计
+	Errors        map[string]int64 `json:"errors"`         //每种操作的内部错误数
+	Written       int64            `json:"written"`        //写入文件的日志数
+	WriteFailed   int64            `json:"write_failed"`   //打开或写入文件失败的日志数
+	LatencyAvg    time.Duration    `json:"latency_avg_ns"` //从调用到写入文件的平均耗时
+	LatencyMax    time.Duration    `json:"latency_max_ns"` //从调用到写入文件的最大耗时
+	Rotations     int64            `json:"rotations"`      //切割次数
+	Archives      int64            `json:"archives"`       //归档次数
+	QueueDepth    int              `json:"queue_depth"`    //异步队列中等待写入的消息数
+	QueueCapacity int              `json:"queue_capacity"` //异步队列的容量
+	Dropped       int64            `json:"dropped"`        //异步队列满时丢弃的消息数
+}
+
+//记录一条日志的等级和分类
+func (this *metrics ) countMsg(level int, category string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.levels == nil {
+		this.levels = make(map[int]int64)
+		this.categories = make(map[string]int64)
+	}
+	this.levels[level]++
+	this.categories[category]++
+}
+
+//记录写入文件的字节数和耗时
+func (this *metrics ) countWrite(filename string, n int64, latency time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.bytes == nil {
+		this.bytes = make(map[string]int64)
+	}
+	this.bytes[filename] += n
+	this.written++
+	this.latencyTotal += latency
+	if latency > this.latencyMax {
+		this.latencyMax = latency
+	}
+}
+
+//记录写入文件失败的日志
+func (this *metrics ) countWriteFailed() {
+	atomic.AddInt64(&this.writeFailed, 1)
+}
+
+//记录内部错误
+func (this *metrics ) countError(op string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.errors == nil {
+		this.errors = make(map[string]int64)
+	}
+	this.errors[op]++
+}
+
+/**
+ * 获取统计数据的快照
+ *
+ * @return Stats
+ *
+ */
+func (this *Flog ) Stats() Stats {
+	m := &this.metrics
+	m.mu.Lock()
+	stats := Stats{
+		Levels:make(map[string]int64, len(m.levels)),
+		Categories:make(map[string]int64, len(m.categories)),
+		Bytes:make(map[string]int64, len(m.bytes)),
+		Errors:make(map[string]int64, len(m.errors)),
+		Written:m.written,
+		WriteFailed:atomic.LoadInt64(&m.writeFailed),
+		LatencyMax:m.latencyMax,
+		Rotations:atomic.LoadInt64(&m.rotations),
+		Archives:atomic.LoadInt64(&m.archives),
+	}
+	for level, n := range m.levels {
+		stats.Levels[LevelName(level)] = n
+	}
+	for category, n := range m.categories {
+		stats.Categories[category] = n
+	}
+	for filename, n := range m.bytes {
+		stats.Bytes[filename] = n
+	}
+	for op, n := range m.errors {
+		stats.Errors[op] = n
+	}
+	if m.written > 0 {
+		stats.LatencyAvg = m.latencyTotal / time.Duration(m.written)
+	}
+	m.mu.Unlock()
+
+	stats.QueueDepth = len(this.msgChan)
+	stats.QueueCapacity = cap(this.msgChan)
+	stats.Dropped = this.Dropped()
+	return stats
+}
+
+/**
+ * 把统计数据以name发布到expvar,通过 /debug/vars 查看
+ * 同一个name只能发布一次,重复发布时expvar会panic
+ *
+ * @param name string
+ * @return *Flog
+ *
+ */
+func (this *Flog ) PublishExpvar(name string) *Flog {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return this.Stats()
+	}))
+	return this
+}
@@ -0,0 +1,113 @@
+package flog
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+//测试统计数据
+func TestStats(t *testing.T) {
+	loger := New("/tmp/flog_stats")
+	os.RemoveAll(loger.LogPath)
+	defer os.RemoveAll(loger.LogPath)
+	loger.FileName = "app.log"
+	loger.LogRotateSize = 1
+	loger.SetAsync(100)
+
+	line := strings.Repeat("x", 100)
+	for i := 0; i < 20; i++ {
+		loger.Info("db", line)
+	}
+	loger.Error("http", "error_message")
+	loger.Flush()
+
+	stats := loger.Stats()
+	if stats.Levels["info"] != 20 || stats.Levels["error"] != 1 {
+		t.Fatal("Level counts are wrong.", stats.Levels)
+	}
+	if stats.Categories["db"] != 20 || stats.Categories["http"] != 1 {
+		t.Fatal("Category counts are wrong.", stats.Categories)
+	}
+	if stats.Written != 21 || stats.LatencyMax <= 0 || stats.LatencyAvg > stats.LatencyMax {
+		t.Fatal("Write latency is wrong.", stats.Written, stats.LatencyAvg, stats.LatencyMax)
+	}
+	if stats.Rotations == 0 {
+		t.Fatal("Rotations should be counted")
+	}
+	if stats.QueueCapacity != 100 || stats.QueueDepth != 0 {
+		t.Fatal("Queue depth is wrong.", stats.QueueDepth, stats.QueueCapacity)
+	}
+
+	//写入的字节数等于所有文件的大小之和
+	var size int64
+	files, _ := os.ReadDir(loger.LogPath)
+	for _, f := range files {
+		if info, err := os.Stat(path.Join(loger.LogPath, f.Name())); err == nil && !strings.HasPrefix(f.Name(), ".") {
+			size += info.Size()
+		}
+	}
+	if stats.Bytes["app.log"] != size {
+		t.Fatal("Bytes written is wrong.", stats.Bytes, size)
+	}
+	loger.Close()
+}
+
+//测试发布到expvar
+func TestPublishExpvar(t *testing.T) {
+	loger := New("/tmp/flog_expvar")
+	defer os.RemoveAll(loger.LogPath)
+	loger.PublishExpvar("flog_test")
+	loger.Warning("d", "warning_message")
+
+	var stats Stats
+	if err := json.Unmarshal([]byte(expvar.Get("flog_test").String()), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Levels["warning"] != 1 || stats.Written != 1 {
+		t.Fatal("Expvar stats are wrong.", stats)
+	}
+}
+
+//测试写入失败的日志不计入写入数
+func TestStatsWriteFailed(t *testing.T) {
+	loger := New("/tmp/flog_stats_failed")
+	defer os.RemoveAll(loger.LogPath)
+	loger.ErrorHandler = func(op string, err error) {}
+	loger.Info("d", "written")
+	loger.mu.Lock()
+	loger.logerMap[loger.FileName].SetOutput(failWriter{})
+	loger.mu.Unlock()
+	loger.Info("d", "failed")
+
+	stats := loger.Stats()
+	if stats.Written != 1 || stats.WriteFailed != 1 || stats.Errors["write"] != 1 {
+		t.Fatal("Failed writes should be counted separately.", stats.Written, stats.WriteFailed, stats.Errors)
+	}
+	if info, err := os.Stat(path.Join(loger.LogPath, loger.FileName)); err != nil || stats.Bytes[loger.FileName] != info.Size() {
+		t.Fatal("Bytes of failed writes should not be counted.", stats.Bytes)
+	}
+}
+
+//测试按日期命名时写入的字节数按不带日期的日志名统计
+func TestStatsBytesDateFormat(t *testing.T) {
+	loger := New("/tmp/flog_stats_date")
+	os.RemoveAll(loger.LogPath)
+	defer os.RemoveAll(loger.LogPath)
+	loger.DateFormat = "Ymd"
+	loger.LogMode = LOGMODE_CATE
+	loger.Info("db", "info_message")
+	loger.Info("db", "info_message")
+
+	stats := loger.Stats()
+	info, err := os.Stat(path.Join(loger.LogPath, "db." + Date("Ymd")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Bytes) != 1 || stats.Bytes["db"] != info.Size() {
+		t.Fatal("Bytes should be keyed by the log name without date.", stats.Bytes)
+	}
+}
@@ -0,0 +1,322 @@
+package flog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//syslog协议
+const (
+	SYSLOG_RFC5424 = iota        //新格式,分类作为MSGID,字段作为structured data
+	SYSLOG_RFC3164                //BSD格式
+)
+
+//syslog facility,零值表示默认的SYSLOG_USER
+const (
+	SYSLOG_USER = iota + 1
+	SYSLOG_MAIL
+	SYSLOG_DAEMON
+	SYSLOG_AUTH
+	SYSLOG_SYSLOG
+	SYSLOG_LPR
+	SYSLOG_NEWS
+	SYSLOG_UUCP
+	SYSLOG_CRON
+	SYSLOG_AUTHPRIV
+	SYSLOG_FTP
+	_
+	_
+	_
+	_
+	SYSLOG_LOCAL0
+	SYSLOG_LOCAL1
+	SYSLOG_LOCAL2
+	SYSLOG_LOCAL3
+	SYSLOG_LOCAL4
+	SYSLOG_LOCAL5
+	SYSLOG_LOCAL6
+	SYSLOG_LOCAL7
+)
+
+//kern的facility代码为0,零值已经表示SYSLOG_USER,用-1表示
+const SYSLOG_KERN = -1
+
+//重连的退避时间内不再连接
+var ErrSyslogUnavailable = errors.New("flog: syslog is unavailable, waiting to reconnect")
+
+//日志等级对应的syslog severity
+var syslogSeverities = map[int]int{
+	LEVEL_TRACE:7,
+	LEVEL_DEBUG:7,
+	LEVEL_INFO:6,
+	LEVEL_WARNING:4,
+	LEVEL_ERROR:3,
+	LEVEL_PANIC:2,
+	LEVEL_FATAL:2,
+}
+
+//本机syslog的socket
+var syslogLocalAddrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+//structured data的id,32473是文档保留的企业编号
+const syslogSDID = "fields@32473"
+
+/**
+ * 输出到syslog,支持udp tcp unix unixgram
+ * tcp和unix默认使用octet counting分帧(RFC 6587),写失败时会重连一次
+ * 连接失败之后按MinBackoff到MaxBackoff的退避时间重连,期间直接返回ErrSyslogUnavailable,不会阻塞写日志
+ */
+type SyslogSink struct {
+	mu                    sync.Mutex
+	Network               string    //udp tcp unix unixgram,为空时连接本机的syslog
+	Addr                  string    //地址,eg. 127.0.0.1:514 /dev/log
+	Protocol              int       //SYSLOG_RFC5424 或 SYSLOG_RFC3164
+	Facility              int       //SYSLOG_*,默认SYSLOG_USER
+	AppName               string    //默认为进程名
+	Hostname              string    //默认为本机hostname
+	Formatter             Formatter //消息内容的格式,默认只有消息内容
+	NonTransparentFraming bool      //tcp和unix下使用换行分帧而不是octet counting
+	DialTimeout           int       //连接超时,单位毫秒,默认3000
+	MinBackoff            int       //重连的最小间隔,单位毫秒,默认100
+	MaxBackoff            int       //重连的最大间隔,单位毫秒,默认30000
+	conn                  net.Conn
+	network               string    //实际连接的network
+	backoff               time.Duration //当前的重连间隔
+	nextDial              time.Time     //下次允许重连的时间
+}
+
+/**
+ * 实例化一个syslog输出
+ *
+ * @param network string udp tcp unix unixgram,为空时连接本机的syslog
+ * @param addr string 地址
+ * @param facility int SYSLOG_*
+ * @param appName string 应用名
+ * @return *SyslogSink
+ *
+ */
+func NewSyslogSink(network, addr string, facility int, appName string) *SyslogSink {
+	return &SyslogSink{Network:network, Addr:addr, Facility:facility, AppName:appName}
+}
+
+func (this *SyslogSink ) Write(msg *LogMsg) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.conn == nil {
+		if err := this.dial(); err != nil {
+			return err
+		}
+	}
+	b := this.frame(this.format(msg))
+	if _, err := this.conn.Write(b); err != nil {
+		//重连之后再写一次
+		this.conn.Close()
+		this.conn = nil
+		if err := this.dial(); err != nil {
+			return err
+		}
+		if _, err := this.conn.Write(b); err != nil {
+			this.fail()
+			return err
+		}
+	}
+	return nil
+}
+
+//按退避时间连接,退避时间内直接返回ErrSyslogUnavailable
+func (this *SyslogSink ) dial() error {
+	if time.Now().Before(this.nextDial) {
+		return ErrSyslogUnavailable
+	}
+	if err := this.connect(); err != nil {
+		this.fail()
+		return err
+	}
+	this.backoff = 0
+	return nil
+}
+
+//连接失败,关闭连接并计算下次重连的时间
+func (this *SyslogSink ) fail() {
+	if this.conn != nil {
+		this.conn.Close()
+		this.conn = nil
+	}
+	this.backoff = nextBackoff(this.backoff, this.MinBackoff, this.MaxBackoff)
+	this.nextDial = time.Now().Add(this.backoff)
+}
+
+func (this *SyslogSink ) Flush() error {
+	return nil
+}
+
+func (this *SyslogSink ) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.conn == nil {
+		return nil
+	}
+	err := this.conn.Close()
+	this.conn = nil
+	return err
+}
+
+//建立连接
+func (this *SyslogSink ) connect() error {
+	timeout := time.Duration(this.DialTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	if len(this.Network) > 0 {
+		conn, err := net.DialTimeout(this.Network, this.Addr, timeout)
+		if err != nil {
+			return err
+		}
+		this.conn = conn
+		this.network = this.Network
+		return nil
+	}
+	//本机syslog
+	addrs := syslogLocalAddrs
+	if len(this.Addr) > 0 {
+		addrs = []string{this.Addr}
+	}
+	for _, addr := range addrs {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, addr, timeout)
+			if err == nil {
+				this.conn = conn
+				this.network = network
+				return nil
+			}
+		}
+	}
+	return errors.New("flog: unix syslog delivery error")
+}
+
+//按连接类型分帧,流式连接需要分帧,数据报一个包一条消息
+func (this *SyslogSink ) frame(line string) []byte {
+	switch this.network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		if this.NonTransparentFraming {
+			return []byte(line + "\n")
+		}
+		return []byte(strconv.Itoa(len(line)) + " " + line)
+	}
+	return []byte(line)
+}
+
+//按协议格式化一条syslog消息
+func (this *SyslogSink ) format(msg *LogMsg) string {
+	severity, ok := syslogSeverities[msg.Level]
+	if !ok {
+		severity = 6
+	}
+	facility := this.Facility
+	switch facility {
+	case 0:
+		facility = SYSLOG_USER
+	case SYSLOG_KERN:
+		facility = 0
+	}
+	pri := "<" + strconv.Itoa(facility * 8 + severity) + ">"
+
+	hostname := this.Hostname
+	if len(hostname) == 0 {
+		hostname, _ = os.Hostname()
+	}
+	appName := this.AppName
+	if len(appName) == 0 {
+		appName = syslogName(os.Args[0])
+	}
+	pid := strconv.Itoa(os.Getpid())
+
+	content := msg.Message
+	if this.Formatter != nil {
+		if b, err := this.Formatter.Format(msg); err == nil {
+			content = string(b)
+		}
+	}
+	content = strings.TrimRight(content, "\n")
+
+	if this.Protocol == SYSLOG_RFC3164 {
+		if this.Formatter == nil {
+			if len(msg.Category) > 0 {
+				content = "[" + msg.Category + "] " + content
+			}
+			content += formatFields(msg.Fields)
+		}
+		return pri + msg.Time.Format(time.Stamp) + " " + syslogHeader(hostname, 255) + " " +
+		syslogHeader(appName, 32) + "[" + pid + "]: " + content
+	}
+
+	sd := "-"
+	if len(msg.Fields) > 0 {
+		sd = syslogStructuredData(msg.Fields)
+	}
+	return pri + "1 " + msg.Time.Format("2006-01-02T15:04:05.000000Z07:00") + " " +
+	syslogHeader(hostname, 255) + " " + syslogHeader(appName, 48) + " " + pid + " " +
+	syslogHeader(msg.Category, 32) + " " + sd + " " + content
+}
+
+//进程名
+func syslogName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i + 1:]
+	}
+	return name
+}
+
+//header中的字段只能是可打印的ascii且不能有空格,为空时用 - 表示
+func syslogHeader(s string, max int) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+//把字段转换成structured data eg. [fields@32473 uid="1001"]
+func syslogStructuredData(fields []Field) string {
+	var buf strings.Builder
+	buf.WriteString("[" + syslogSDID)
+	for _, f := range fields {
+		name := []byte(f.Key)
+		for i, c := range name {
+			if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+				name[i] = '_'
+			}
+		}
+		if len(name) == 0 {
+			continue
+		}
+		if len(name) > 32 {
+			name = name[:32]
+		}
+		buf.WriteByte(' ')
+		buf.Write(name)
+		buf.WriteString(`="`)
+		if err, ok := f.Value.(error); ok {
+			f.Value = err.Error()
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(fmt.Sprint(f.Value))
+		buf.WriteString(v)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
@@ -0,0 +1,144 @@
+package flog
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//测试udp输出RFC5424
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	loger := New("/tmp/flog_syslog")
+	defer os.RemoveAll(loger.LogPath)
+	loger.DisableFileLog = true
+	sink := NewSyslogSink("udp", pc.LocalAddr().String(), SYSLOG_LOCAL0, "app")
+	sink.Hostname = "host"
+	loger.AddSink(sink)
+	loger.Warningw("db.query", "slow query", "cost", "1s", "sql", `select "x"`)
+	loger.Close()
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(buf[:n])
+	//local0 * 8 + warning(4)
+	prefix := "<132>1 "
+	suffix := " host app " + strconv.Itoa(os.Getpid()) + ` db.query [fields@32473 cost="1s" sql="select \"x\""] slow query`
+	if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, suffix) {
+		t.Fatal("Syslog message does not show as expected.", line)
+	}
+}
+
+//测试tcp输出RFC3164,octet counting分帧以及断线重连
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	sink := NewSyslogSink("tcp", ln.Addr().String(), SYSLOG_USER, "app")
+	sink.Protocol = SYSLOG_RFC3164
+	sink.Hostname = "host"
+	msg := &LogMsg{Time:time.Now(), Level:LEVEL_ERROR, Category:"c", Message:"boom\n"}
+	if err := sink.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	conn := <-conns
+	r := bufio.NewReader(conn)
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(length))
+	b := make([]byte, n)
+	if _, err := r.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "host app[" + strconv.Itoa(os.Getpid()) + "]: [c] boom"
+	if !strings.HasPrefix(string(b), "<11>") || !strings.HasSuffix(string(b), expected) {
+		t.Fatal("Syslog message does not show as expected.", string(b))
+	}
+
+	//服务端断开之后继续写,需要自动重连
+	conn.Close()
+	timeout := time.After(3 * time.Second)
+	for {
+		sink.Write(msg)
+		select {
+		case c := <-conns:
+			c.Close()
+			sink.Close()
+			return
+		case <-timeout:
+			t.Fatal("Syslog sink did not reconnect")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+//测试facility,零值为SYSLOG_USER,SYSLOG_KERN的代码为0
+func TestSyslogFacility(t *testing.T) {
+	msg := &LogMsg{Time:time.Now(), Level:LEVEL_ERROR, Message:"m"}
+	cases := map[int]string{
+		0:"<11>",
+		SYSLOG_USER:"<11>",
+		SYSLOG_KERN:"<3>",
+		SYSLOG_LOCAL7:"<187>",
+	}
+	for facility, pri := range cases {
+		sink := &SyslogSink{Network:"udp", Addr:"127.0.0.1:514", Facility:facility}
+		if line := sink.format(msg); !strings.HasPrefix(line, pri) {
+			t.Fatal("Facility", facility, "should have PRI", pri, line)
+		}
+	}
+}
+
+//测试连接失败之后在退避时间内不再连接
+func TestSyslogBackoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sink := NewSyslogSink("tcp", addr, SYSLOG_USER, "app")
+	sink.MinBackoff = 60000
+	msg := &LogMsg{Time:time.Now(), Level:LEVEL_ERROR, Message:"m"}
+	if err := sink.Write(msg); err == nil || err == ErrSyslogUnavailable {
+		t.Fatal("First write should try to connect,", err)
+	}
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := sink.Write(msg); err != ErrSyslogUnavailable {
+			t.Fatal("Writes should fail fast during the backoff,", err)
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Writes during the backoff should not dial")
+	}
+}